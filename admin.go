@@ -0,0 +1,242 @@
+package mwclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// TagResult is the result of changing the tags of a single revision or
+// log entry with Client.AddTags.
+type TagResult struct {
+	// Either RevID or LogID is set, depending on the target.
+	RevID int `json:"revid"`
+	LogID int `json:"logid"`
+	// Status is "success" or "error".
+	Status string `json:"status"`
+	// NoOp is true if the tags of the target were not changed.
+	NoOp        bool     `json:"noop"`
+	ActionLogID int      `json:"actionlogid"`
+	Added       []string `json:"added"`
+	Removed     []string `json:"removed"`
+	// If Status is "error", Code and Info describe the error.
+	Code string `json:"code"`
+	Info string `json:"info"`
+}
+
+// AddTags adds the change tags add to and removes the tags remove from
+// the revisions revids and the log entries logids (action=tag).
+// reason is used as the reason in the tag log.
+// AddTags returns a result for each revision and log entry. A failure
+// to modify one target does not cause AddTags to return an error.
+// If the user is not allowed to change tags, a PermissionError is returned.
+func (w *Client) AddTags(revids, logids []int, add, remove []string, reason string) ([]TagResult, error) {
+	if len(revids) == 0 && len(logids) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	p := params.Values{"action": "tag"}
+	if len(revids) > 0 {
+		p.AddRange("revid", itoaSlice(revids)...)
+	}
+	if len(logids) > 0 {
+		p.AddRange("logid", itoaSlice(logids)...)
+	}
+	if len(add) > 0 {
+		p.AddRange("add", add...)
+	}
+	if len(remove) > 0 {
+		p.AddRange("remove", remove...)
+	}
+	if reason != "" {
+		p["reason"] = reason
+	}
+
+	resp, err := w.postWithToken(CSRFToken, p)
+	if err != nil {
+		return nil, err
+	}
+	if w.DryRun {
+		return nil, nil
+	}
+
+	var r struct {
+		Tag []TagResult `json:"tag"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+	return r.Tag, nil
+}
+
+// Move moves the page from to the title to (action=move). reason is used as
+// the reason in the move log. p can contain additional parameters, e.g.
+// movetalk to move the talk page too or noredirect to not leave a redirect
+// behind; it may be nil.
+// If the page does not exist, ErrPageNotFound is returned. If the user is not
+// allowed to move the page, a PermissionError is returned.
+func (w *Client) Move(from, to, reason string, p params.Values) error {
+	q := params.Values{
+		"action": "move",
+		"from":   from,
+		"to":     to,
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	if reason != "" {
+		q["reason"] = reason
+	}
+	return w.pageAction(q)
+}
+
+// Delete deletes the page title (action=delete). reason is used as the reason
+// in the deletion log.
+// If the page does not exist, ErrPageNotFound is returned. If the user is not
+// allowed to delete the page, a PermissionError is returned.
+func (w *Client) Delete(title, reason string) error {
+	p := params.Values{
+		"action": "delete",
+		"title":  title,
+	}
+	if reason != "" {
+		p["reason"] = reason
+	}
+	return w.pageAction(p)
+}
+
+// Protect changes the protection levels of the page title (action=protect).
+// protections is a list of action=level pairs separated by pipes,
+// e.g. "edit=sysop|move=sysop". Setting the level "all" removes the protection
+// of an action. The protections are indefinite; to protect the page
+// temporarily, do the request with Post and set expiry. reason is used as
+// the reason in the protection log.
+// If the page does not exist, ErrPageNotFound is returned. If the user is not
+// allowed to protect the page, a PermissionError is returned.
+func (w *Client) Protect(title, protections, reason string) error {
+	p := params.Values{
+		"action":      "protect",
+		"title":       title,
+		"protections": protections,
+	}
+	if reason != "" {
+		p["reason"] = reason
+	}
+	return w.pageAction(p)
+}
+
+// pageAction POSTs the request p for an action on a page (such as
+// action=delete) and checks that its result contains an object named after
+// the action.
+func (w *Client) pageAction(p params.Values) error {
+	resp, err := w.postWithToken(CSRFToken, p)
+	if apierr, ok := err.(APIError); ok && apierr.Code == "missingtitle" {
+		return ErrPageNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := resp.GetObject(p["action"]); err != nil {
+		return fmt.Errorf("unrecognized response: %v", resp)
+	}
+	return nil
+}
+
+// itoaSlice converts a slice of ints to a slice of strings.
+func itoaSlice(ints []int) []string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return s
+}
+
+// ErrPasswordResetDisabled is returned by Client.ResetPassword when password
+// resets are disabled on the wiki.
+var ErrPasswordResetDisabled = errors.New("password reset is disabled on this wiki")
+
+// ResetPassword sends a password reset email to the user (action=resetpassword).
+// If the client does not have the right to reset passwords, a PermissionError
+// is returned. If password resets are disabled, ErrPasswordResetDisabled
+// is returned.
+func (w *Client) ResetPassword(user string) error {
+	p := params.Values{
+		"action": "resetpassword",
+		"user":   user,
+	}
+
+	resp, err := w.postWithToken(CSRFToken, p)
+	if apierr, ok := err.(APIError); ok && apierr.Code == "passwordreset-disabled" {
+		return ErrPasswordResetDisabled
+	}
+	if err != nil || w.DryRun {
+		return err
+	}
+
+	status, err := resp.GetString("resetpassword", "status")
+	if err != nil || status != "success" {
+		result, _ := resp.GetValue("resetpassword")
+		return fmt.Errorf("unrecognized response: %v", result)
+	}
+	return nil
+}
+
+// ErrRevisionNotFound is returned when a requested revision does not exist.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// DeletedRevisionContent returns the content of the deleted revision of the
+// page title with the timestamp (in ISO 8601 format, e.g.
+// "2026-01-01T00:00:00Z"), using prop=deletedrevisions. Viewing deleted
+// revisions requires the deletedhistory and deletedtext rights; if the client
+// does not have them, a PermissionError is returned. If there is no deleted
+// revision with the timestamp, ErrRevisionNotFound is returned.
+func (w *Client) DeletedRevisionContent(title string, timestamp string) (string, error) {
+	p := params.Values{
+		"action":   "query",
+		"prop":     "deletedrevisions",
+		"titles":   title,
+		"drvprop":  "content|timestamp",
+		"drvslots": "main",
+		"drvstart": timestamp,
+		"drvend":   timestamp,
+	}
+
+	resp, err := w.Get(p)
+	if resp == nil {
+		return "", err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return "", err
+	}
+	warnings := err
+
+	var r struct {
+		Query struct {
+			Pages []struct {
+				DeletedRevisions []struct {
+					Timestamp string `json:"timestamp"`
+					Slots     struct {
+						Main struct {
+							Content string `json:"content"`
+						} `json:"main"`
+					} `json:"slots"`
+				} `json:"deletedrevisions"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return "", err
+	}
+	for _, page := range r.Query.Pages {
+		for _, rev := range page.DeletedRevisions {
+			if rev.Timestamp == timestamp {
+				return w.normalizeContent(rev.Slots.Main.Content), warnings
+			}
+		}
+	}
+
+	return "", ErrRevisionNotFound
+}
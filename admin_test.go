@@ -0,0 +1,231 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestAddTags(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "tag" {
+			t.Fatalf("action != tag: action=%s", v)
+		}
+		if v := r.Form.Get("revid"); v != "1|2" {
+			t.Fatalf("revid != 1|2: revid=%s", v)
+		}
+		if v := r.Form.Get("add"); v != "mytag" {
+			t.Fatalf("add != mytag: add=%s", v)
+		}
+
+		fmt.Fprint(w, `{"tag":[{"revid":1,"status":"success","actionlogid":10,
+		"added":["mytag"],"removed":[]},{"revid":2,"status":"success","noop":true}]}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	results, err := client.AddTags([]int{1, 2}, nil, []string{"mytag"}, nil, "")
+	if err != nil {
+		t.Fatalf("AddTags returned error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].ActionLogID != 10 || len(results[0].Added) != 1 {
+		t.Errorf("unexpected first result: %+v", results[0])
+	}
+	if !results[1].NoOp {
+		t.Errorf("expected second result to be a no-op: %+v", results[1])
+	}
+}
+
+func TestAddTagsPermissionDenied(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"permissiondenied",
+		"info":"You don't have permission to apply change tags along with your changes."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	_, err := client.AddTags([]int{1}, nil, []string{"mytag"}, nil, "")
+	if _, ok := err.(PermissionError); !ok {
+		t.Fatalf("expected PermissionError, got %#v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "resetpassword" {
+			t.Fatalf("action != resetpassword: action=%s", v)
+		}
+		if v := r.Form.Get("user"); v != "Example" {
+			t.Fatalf("user != Example: user=%s", v)
+		}
+
+		fmt.Fprint(w, `{"resetpassword":{"status":"success"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if err := client.ResetPassword("Example"); err != nil {
+		t.Fatalf("ResetPassword returned error: %v", err)
+	}
+}
+
+func TestResetPasswordDisabled(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"passwordreset-disabled",
+		"info":"Password resets have been disabled on this wiki."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if err := client.ResetPassword("Example"); err != ErrPasswordResetDisabled {
+		t.Fatalf("expected ErrPasswordResetDisabled, got %#v", err)
+	}
+}
+
+func TestDeletedRevisionContent(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "deletedrevisions" {
+			t.Fatalf("prop != deletedrevisions: prop=%s", v)
+		}
+		if v := r.Form.Get("drvstart"); v != "2026-01-01T00:00:00Z" {
+			t.Fatalf("drvstart != 2026-01-01T00:00:00Z: drvstart=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"Deleted","missing":true,
+		"deletedrevisions":[{"revid":5,"parentid":0,"timestamp":"2026-01-01T00:00:00Z",
+		"slots":{"main":{"contentmodel":"wikitext","content":"Deleted text"}}}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	content, err := client.DeletedRevisionContent("Deleted", "2026-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("DeletedRevisionContent returned error: %v", err)
+	}
+	if content != "Deleted text" {
+		t.Fatalf("content != Deleted text: content=%s", content)
+	}
+}
+
+func TestDeletedRevisionContentPermissionDenied(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"permissiondenied",
+		"info":"You don't have permission to view deleted revision information."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	_, err := client.DeletedRevisionContent("Deleted", "2026-01-01T00:00:00Z")
+	if _, ok := err.(PermissionError); !ok {
+		t.Fatalf("expected PermissionError, got %#v", err)
+	}
+}
+
+func TestPageActions(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.PostForm.Get("token") != "VALIDTOKEN" || r.PostForm.Get("reason") != "Cleanup" {
+			t.Fatalf("token or reason not sent: %v", r.PostForm)
+		}
+		switch r.PostForm.Get("action") {
+		case "move":
+			if r.PostForm.Get("from") != "Old" || r.PostForm.Get("to") != "New" ||
+				r.PostForm.Get("movetalk") != "" {
+				t.Fatalf("unexpected move parameters: %v", r.PostForm)
+			}
+			if _, ok := r.PostForm["movetalk"]; !ok {
+				t.Fatalf("movetalk not set")
+			}
+			fmt.Fprint(w, `{"move":{"from":"Old","to":"New","reason":"Cleanup",
+			"talkfrom":"Talk:Old","talkto":"Talk:New"}}`)
+		case "delete":
+			if r.PostForm.Get("title") == "Missing" {
+				fmt.Fprint(w, `{"error":{"code":"missingtitle","info":"The page you specified doesn't exist."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"delete":{"title":"Old","reason":"Cleanup","logid":42}}`)
+		case "protect":
+			if r.PostForm.Get("protections") != "edit=sysop|move=sysop" {
+				t.Fatalf("protections != edit=sysop|move=sysop: protections=%s", r.PostForm.Get("protections"))
+			}
+			fmt.Fprint(w, `{"protect":{"title":"Old","reason":"Cleanup",
+			"protections":[{"edit":"sysop","expiry":"infinite"},{"move":"sysop","expiry":"infinite"}]}}`)
+		default:
+			t.Fatalf("unexpected action: %s", r.PostForm.Get("action"))
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if err := client.Move("Old", "New", "Cleanup", params.Values{"movetalk": ""}); err != nil {
+		t.Fatalf("Move returned error: %v", err)
+	}
+	if err := client.Delete("Old", "Cleanup"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := client.Delete("Missing", "Cleanup"); err != ErrPageNotFound {
+		t.Fatalf("err != ErrPageNotFound: err=%v", err)
+	}
+	if err := client.Protect("Old", "edit=sysop|move=sysop", "Cleanup"); err != nil {
+		t.Fatalf("Protect returned error: %v", err)
+	}
+}
+
+func TestPageActionsPermissionDenied(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"permissiondenied",
+		"info":"The action you have requested is limited to users in the group: Administrators."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	for name, f := range map[string]func() error{
+		"Move":    func() error { return client.Move("Old", "New", "", nil) },
+		"Delete":  func() error { return client.Delete("Old", "") },
+		"Protect": func() error { return client.Protect("Old", "edit=sysop", "") },
+	} {
+		if err := f(); err == nil {
+			t.Fatalf("%s returned no error", name)
+		} else if _, ok := err.(PermissionError); !ok {
+			t.Fatalf("%s: expected PermissionError, got %#v", name, err)
+		}
+	}
+}
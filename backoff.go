@@ -0,0 +1,77 @@
+package mwclient
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff determines how long the client waits before retrying a request that
+// failed because of a transient error, such as a rate limit or a server that
+// is temporarily unavailable. See Client.SetBackoff.
+// Waiting because of maxlag is not affected; the server specifies how long
+// to wait in that case.
+type Backoff interface {
+	// NextDelay returns how long to wait before retry number attempt,
+	// starting at 1.
+	NextDelay(attempt int) time.Duration
+}
+
+// ConstantBackoff waits the same amount of time before each retry.
+type ConstantBackoff time.Duration
+
+// NextDelay implements Backoff.
+func (b ConstantBackoff) NextDelay(attempt int) time.Duration {
+	return time.Duration(b)
+}
+
+// LinearBackoff waits attempt times its duration before retry number attempt.
+// This is the default with a duration of one second.
+type LinearBackoff time.Duration
+
+// NextDelay implements Backoff.
+func (b LinearBackoff) NextDelay(attempt int) time.Duration {
+	return time.Duration(attempt) * time.Duration(b)
+}
+
+// ExponentialBackoff doubles the delay before each retry, starting at Base,
+// up to Max. If Max is zero, the delay is not capped.
+// If Jitter is true, a random delay between zero and the computed delay is
+// used instead, which prevents many clients from retrying at the same time.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter bool
+}
+
+// NextDelay implements Backoff.
+func (b ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	d := b.Base
+	for i := 1; i < attempt && (b.Max == 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max != 0 && d > b.Max {
+		d = b.Max
+	}
+	if b.Jitter && d > 0 {
+		d = time.Duration(rand.Int63n(int64(d) + 1))
+	}
+	return d
+}
+
+// defaultBackoff is used if no backoff strategy is set with SetBackoff.
+var defaultBackoff Backoff = LinearBackoff(time.Second)
+
+// SetBackoff sets the strategy used for waiting before retrying requests that
+// failed because of transient errors. If b is nil, the default
+// (LinearBackoff(time.Second)) is restored.
+func (w *Client) SetBackoff(b Backoff) {
+	w.backoff = b
+}
+
+// retryDelay returns how long to wait before retry number attempt.
+func (w *Client) retryDelay(attempt int) time.Duration {
+	if w.backoff == nil {
+		return defaultBackoff.NextDelay(attempt)
+	}
+	return w.backoff.NextDelay(attempt)
+}
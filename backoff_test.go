@@ -0,0 +1,72 @@
+package mwclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestBackoffNextDelay(t *testing.T) {
+	cases := []struct {
+		b       Backoff
+		attempt int
+		want    time.Duration
+	}{
+		{ConstantBackoff(time.Second), 3, time.Second},
+		{LinearBackoff(time.Second), 3, 3 * time.Second},
+		{ExponentialBackoff{Base: time.Second}, 1, time.Second},
+		{ExponentialBackoff{Base: time.Second}, 4, 8 * time.Second},
+		{ExponentialBackoff{Base: time.Second, Max: 5 * time.Second}, 4, 5 * time.Second},
+	}
+	for _, c := range cases {
+		if got := c.b.NextDelay(c.attempt); got != c.want {
+			t.Errorf("%#v.NextDelay(%d) != %s: got %s", c.b, c.attempt, c.want, got)
+		}
+	}
+
+	b := ExponentialBackoff{Base: time.Second, Max: 5 * time.Second, Jitter: true}
+	for attempt := 1; attempt <= 10; attempt++ {
+		if d := b.NextDelay(attempt); d < 0 || d > 5*time.Second {
+			t.Errorf("jittered delay out of range: %s", d)
+		}
+	}
+}
+
+func TestSetBackoff(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		if reqCount < 3 {
+			// Transient failure: truncated response.
+			fmt.Fprint(w, `{"query":`)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var waits []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	client.SetBackoff(ExponentialBackoff{Base: 100 * time.Millisecond})
+
+	q := client.NewQuery(params.Values{})
+	q.Retries = 2
+	for q.Next() {
+		continue
+	}
+	if err := q.Err(); err != nil {
+		t.Fatalf("q.Err() != nil: %v", err)
+	}
+	if len(waits) != 2 || waits[0] != 100*time.Millisecond || waits[1] != 200*time.Millisecond {
+		t.Fatalf("unexpected waits: %v", waits)
+	}
+}
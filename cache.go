@@ -0,0 +1,205 @@
+package mwclient
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/antonholmquist/jason"
+)
+
+// responseCache is a concurrency-safe, size-bounded LRU cache of raw API
+// response bodies keyed by their encoded request parameters.
+type responseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	// stale is how long expired entries are served while they are
+	// revalidated in the background. See SetStaleWhileRevalidate.
+	stale   time.Duration
+	ll      *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	key     string
+	body    []byte
+	expires time.Time
+	// etag is the ETag header of the response, if any. Expired entries with
+	// an ETag are kept so that they can be validated with a conditional
+	// request (If-None-Match).
+	etag string
+	// revalidating is true while the entry is being revalidated.
+	revalidating bool
+}
+
+func newResponseCache(maxEntries int, ttl time.Duration) *responseCache {
+	return &responseCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		entries:    map[string]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+// get returns the cached body for key if it exists and has not expired.
+func (c *responseCache) get(key string) ([]byte, bool) {
+	body, _, ok := c.lookup(key)
+	return body, ok
+}
+
+// lookup is like get, but also returns expired entries that may be served
+// while they are revalidated. If revalidate is true, the entry has expired,
+// and the caller is responsible for revalidating it by calling add or, if
+// revalidation fails, cancelRevalidation.
+func (c *responseCache) lookup(key string) (body []byte, revalidate bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if now := c.now(); now.After(entry.expires) {
+		if now.After(entry.expires.Add(c.stale)) {
+			if entry.etag == "" {
+				c.ll.Remove(elem)
+				delete(c.entries, key)
+			}
+			return nil, false, false
+		}
+		revalidate = !entry.revalidating
+		entry.revalidating = true
+	}
+	c.ll.MoveToFront(elem)
+	return entry.body, revalidate, true
+}
+
+// validator returns the body and ETag of the entry for key, whether or not it
+// has expired, if the entry has an ETag.
+func (c *responseCache) validator(key string) (body []byte, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		return entry.body, entry.etag
+	}
+	return nil, ""
+}
+
+// cancelRevalidation marks the entry for key as no longer being revalidated,
+// so that it is revalidated again on the next lookup.
+func (c *responseCache) cancelRevalidation(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).revalidating = false
+	}
+}
+
+// add stores body under key until the cache TTL has passed, evicting the
+// least recently used entry if the cache is full. etag is the ETag of the
+// response, or empty if it had none.
+func (c *responseCache) add(key string, body []byte, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(elem)
+		entry := elem.Value.(*cacheEntry)
+		entry.body = body
+		entry.expires = expires
+		entry.etag = etag
+		entry.revalidating = false
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&cacheEntry{key: key, body: body, expires: expires, etag: etag})
+	if c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// clear removes all entries from the cache.
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// cacheable reports whether the response body may be cached. Responses with
+// API errors are not cached, so that transient errors such as maxlag or
+// ratelimited are not served again. Responses with warnings are cached.
+func cacheable(body []byte) bool {
+	resp, err := jason.NewObjectFromBytes(body)
+	if err != nil {
+		// Not a JSON response, e.g. from GetRaw with a different format.
+		return true
+	}
+	err = extractAPIErrors(resp)
+	_, ok := err.(APIWarnings)
+	return err == nil || ok
+}
+
+// clearCache removes all responses from the cache enabled with SetCache.
+// It is called when the session changes (e.g. on login), because responses
+// such as meta=userinfo depend on the user the client is authenticated as,
+// and after writes, which may change the responses.
+func (w *Client) clearCache() {
+	if w.cache != nil {
+		w.cache.clear()
+	}
+}
+
+// SetCache enables an in-memory cache of responses to GET requests.
+// Up to maxEntries responses are cached, each for the duration ttl, after
+// which an identical request will be sent to the API again. The cache is
+// keyed by the encoded request parameters, and is cleared when the client
+// logs in or out. Responses with API errors are not cached.
+// POST requests (i.e., writes) and requests made with GetFresh are never
+// served from the cache, and the cache is cleared after each POST request
+// other than those made with PostIdempotent, so that reads after a write do
+// not return outdated responses.
+// If a cached response had an ETag header, it is kept after it expires, and
+// an identical request is sent as a conditional request (If-None-Match).
+// If the server responds that the response has not been modified, the cached
+// response is used again, saving bandwidth.
+// If maxEntries is less than 1 or ttl is not positive, the cache is disabled
+// (the default).
+func (w *Client) SetCache(maxEntries int, ttl time.Duration) {
+	if maxEntries < 1 || ttl <= 0 {
+		w.cache = nil
+		return
+	}
+	w.cache = newResponseCache(maxEntries, ttl)
+}
+
+// SetStaleWhileRevalidate makes the cache enabled with SetCache serve expired
+// responses for up to the duration stale after they have expired, while
+// an identical request is sent to the API in the background to update the
+// cache. This reduces the latency of requests that are repeated frequently,
+// at the cost of sometimes returning outdated responses. If stale is not
+// positive, expired responses are not served (the default).
+// SetStaleWhileRevalidate has no effect if the cache is disabled, and must be
+// called again after calling SetCache.
+func (w *Client) SetStaleWhileRevalidate(stale time.Duration) {
+	if w.cache == nil {
+		return
+	}
+	if stale < 0 {
+		stale = 0
+	}
+	w.cache.mu.Lock()
+	w.cache.stale = stale
+	w.cache.mu.Unlock()
+}
@@ -0,0 +1,248 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestCacheGet(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		fmt.Fprintf(w, `{"query":{"count":%d}}`, reqCount)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetCache(10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(params.Values{"action": "query"})
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if n, _ := resp.GetInt64("query", "count"); n != 1 {
+			t.Fatalf("expected cached response with count 1, got %d", n)
+		}
+	}
+	if reqCount != 1 {
+		t.Fatalf("expected 1 request, got %d", reqCount)
+	}
+
+	if _, err := client.GetFresh(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("GetFresh returned error: %v", err)
+	}
+	if _, err := client.Post(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("Post returned error: %v", err)
+	}
+	if reqCount != 3 {
+		t.Fatalf("expected GetFresh and Post to bypass cache, got %d requests", reqCount)
+	}
+}
+
+func TestCacheExpiryAndEviction(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.add("a", []byte("a"), "")
+	c.add("b", []byte("b"), "")
+	c.get("a") // a is now more recently used than b
+	c.add("c", []byte("c"), "")
+
+	if _, ok := c.get("b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("expected recently used entry to be kept")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Error("expected expired entry to be dropped")
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var reqCount int32
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&reqCount, 1)
+		fmt.Fprintf(w, `{"query":{"count":%d}}`, n)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetCache(10, time.Minute)
+	client.SetStaleWhileRevalidate(time.Hour)
+	now := time.Now()
+	client.cache.now = func() time.Time { return now }
+
+	p := params.Values{"action": "query"}
+	if _, err := client.Get(p); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	// The expired response is served while it is revalidated.
+	now = now.Add(2 * time.Minute)
+	resp, err := client.Get(p)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if n, _ := resp.GetInt64("query", "count"); n != 1 {
+		t.Fatalf("expected stale response with count 1, got %d", n)
+	}
+
+	// Wait for the revalidation to finish.
+	client.Close()
+	if n := atomic.LoadInt32(&reqCount); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+	body, ok := client.cache.get(p.Encode())
+	if !ok || string(body) != `{"query":{"count":2}}` {
+		t.Fatalf("cache entry not revalidated: %s", body)
+	}
+}
+
+func TestCacheETag(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintf(w, `{"query":{"count":%d}}`, reqCount)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetCache(10, time.Minute)
+	now := time.Now()
+	client.cache.now = func() time.Time { return now }
+
+	p := params.Values{"action": "query"}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(p)
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if n, _ := resp.GetInt64("query", "count"); n != 1 {
+			t.Fatalf("expected cached response with count 1, got %d", n)
+		}
+		now = now.Add(2 * time.Minute)
+	}
+	if reqCount != 2 {
+		t.Fatalf("expected 2 requests, got %d", reqCount)
+	}
+}
+
+func TestCacheClearedOnLogin(t *testing.T) {
+	userinfoCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch {
+		case r.Form.Get("meta") == "tokens":
+			fmt.Fprint(w, `{"query":{"tokens":{"logintoken":"LOGINTOKEN"}}}`)
+		case r.Form.Get("action") == "login":
+			fmt.Fprint(w, `{"login":{"result":"Success"}}`)
+		case r.Form.Get("meta") == "userinfo":
+			userinfoCount++
+			fmt.Fprintf(w, `{"query":{"userinfo":{"id":%d}}}`, userinfoCount)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetCache(10, time.Minute)
+
+	p := params.Values{"action": "query", "meta": "userinfo"}
+	if _, err := client.Get(p); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if err := client.Login("username", "password"); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	resp, err := client.Get(p)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if id, _ := resp.GetInt64("query", "userinfo", "id"); id != 2 {
+		t.Fatalf("expected response from after login with id 2, got %d", id)
+	}
+}
+
+func TestCacheClearedAfterEdit(t *testing.T) {
+	content := "old"
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("action") == "edit" {
+			content = r.Form.Get("text")
+			fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"PAGE",
+			"oldrevid":1,"newrevid":2,"newtimestamp":"2020-01-01T00:00:00Z"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"query":{"content":%q}}`, content)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetCache(10, time.Minute)
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+
+	p := params.Values{"action": "query", "titles": "PAGE"}
+	if _, err := client.Get(p); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if err := client.Edit(params.Values{"title": "PAGE", "text": "new"}); err != nil {
+		t.Fatalf("Edit returned error: %v", err)
+	}
+	resp, err := client.Get(p)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if v, _ := resp.GetString("query", "content"); v != "new" {
+		t.Fatalf("expected content from after the edit, got %s", v)
+	}
+}
+
+func TestCacheAPIError(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		if reqCount == 1 {
+			fmt.Fprint(w, `{"error":{"code":"ratelimited","info":"You've exceeded your rate limit."}}`)
+			return
+		}
+		fmt.Fprint(w, `{"query":{"count":2}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.SetCache(10, time.Minute)
+
+	p := params.Values{"action": "query"}
+	if _, err := client.Get(p); err == nil {
+		t.Fatal("expected ratelimited error")
+	}
+	resp, err := client.Get(p)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if n, _ := resp.GetInt64("query", "count"); n != 2 {
+		t.Fatalf("expected uncached response with count 2, got %d", n)
+	}
+}
@@ -0,0 +1,132 @@
+package mwclient
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// categoriesChunkSize is the maximum amount of categories sent in one
+// clcategories parameter.
+const categoriesChunkSize = 50
+
+// PageInCategories reports which of the categories the page title is a
+// member of (prop=categories with clcategories). The categories must be full
+// titles including the namespace prefix (e.g., "Category:Living people").
+// PageInCategories returns a map of the input categories to whether the page
+// is in that category.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) PageInCategories(title string, categories []string) (map[string]bool, error) {
+	if len(categories) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	members := make(map[string]bool, len(categories))
+	for _, chunk := range chunk(categories, categoriesChunkSize) {
+		p := params.Values{
+			"prop":    "categories",
+			"titles":  title,
+			"cllimit": "max",
+		}
+		p.AddRange("clcategories", chunk...)
+
+		found := map[string]bool{}
+		err := w.queryEach(p, func(resp *jason.Object) error {
+			var r struct {
+				Query struct {
+					Pages []struct {
+						Missing    bool `json:"missing"`
+						Categories []struct {
+							Title string `json:"title"`
+						} `json:"categories"`
+					} `json:"pages"`
+				} `json:"query"`
+			}
+			if err := unmarshalObject(resp, &r); err != nil {
+				return err
+			}
+			for _, page := range r.Query.Pages {
+				if page.Missing {
+					return ErrPageNotFound
+				}
+				for _, cat := range page.Categories {
+					found[cat.Title] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// The API returns normalized titles, so underscores in the input
+		// categories have to be replaced to find them.
+		for _, cat := range chunk {
+			members[cat] = found[strings.Replace(cat, "_", " ", -1)]
+		}
+	}
+
+	return members, nil
+}
+
+// CategoryMember is a page in a category, as returned by
+// Client.CategoryMembers.
+type CategoryMember struct {
+	PageID int    `json:"pageid"`
+	NS     int    `json:"ns"`
+	Title  string `json:"title"`
+	// Type is "page", "subcat", or "file".
+	Type string `json:"type"`
+}
+
+// CategoryMembers lists the pages in category (list=categorymembers). The
+// "Category:" prefix is added to category if it does not start with it, so
+// both "Living people" and "Category:Living people" can be passed; localized
+// namespace names are not recognized. p may contain any list=categorymembers
+// parameters, e.g. "cmnamespace", "cmtype" to only list pages, subcategories,
+// or files, or "cmsort". f is called with at most limit members, continuing the
+// query as needed; if limit is zero or negative, it is called with all
+// members, which may be millions in large categories.
+// See https://www.mediawiki.org/wiki/API:Categorymembers
+func (w *Client) CategoryMembers(category string, p params.Values, limit int, f func(member CategoryMember) error) error {
+	if !strings.HasPrefix(strings.ToLower(category), "category:") {
+		category = "Category:" + category
+	}
+
+	q := params.Values{
+		"cmprop":  "ids|title|type",
+		"cmlimit": "max",
+	}
+	if limit > 0 && limit < 500 {
+		q.Set("cmlimit", strconv.Itoa(limit))
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("list", "categorymembers")
+	q.Set("cmtitle", category)
+
+	n := 0
+	return w.queryEach(q, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				CategoryMembers []CategoryMember `json:"categorymembers"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, member := range r.Query.CategoryMembers {
+			if err := f(member); err != nil {
+				return err
+			}
+			if n++; n == limit {
+				return errStopQuery
+			}
+		}
+		return nil
+	})
+}
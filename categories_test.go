@@ -0,0 +1,110 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestPageInCategories(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "categories" {
+			t.Fatalf("prop != categories: prop=%s", v)
+		}
+		if v := r.Form.Get("clcategories"); v != "Category:Living_people|Category:Stubs" {
+			t.Fatalf("clcategories != Category:Living_people|Category:Stubs: clcategories=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":1,"ns":0,"title":"Foo","categories":[{"ns":14,"title":"Category:Living people"}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	members, err := client.PageInCategories("Foo", []string{"Category:Living_people", "Category:Stubs"})
+	if err != nil {
+		t.Fatalf("PageInCategories returned error: %v", err)
+	}
+	if !members["Category:Living_people"] {
+		t.Errorf("page not reported as member of Category:Living_people")
+	}
+	if members["Category:Stubs"] {
+		t.Errorf("page reported as member of Category:Stubs")
+	}
+}
+
+func TestCategoryMembers(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "categorymembers" {
+			t.Fatalf("list != categorymembers: list=%s", v)
+		}
+		if v := r.Form.Get("cmtitle"); v != "Category:Example" {
+			t.Fatalf("cmtitle != Category:Example: cmtitle=%s", v)
+		}
+		if v := r.Form.Get("cmtype"); v != "page|subcat" {
+			t.Fatalf("cmtype != page|subcat: cmtype=%s", v)
+		}
+
+		reqCount++
+		if reqCount == 1 {
+			fmt.Fprint(w, `{"continue":{"cmcontinue":"page|42|2","continue":"-||"},
+			"query":{"categorymembers":[{"pageid":1,"ns":0,"title":"Foo","type":"page"},
+			{"pageid":2,"ns":14,"title":"Category:Bar","type":"subcat"}]}}`)
+			return
+		}
+		if v := r.Form.Get("cmcontinue"); v != "page|42|2" {
+			t.Fatalf("cmcontinue != page|42|2: cmcontinue=%s", v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,
+		"query":{"categorymembers":[{"pageid":3,"ns":0,"title":"Baz","type":"page"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	p := params.Values{"cmtype": "page|subcat"}
+	for _, category := range []string{"Example", "Category:Example"} {
+		reqCount = 0
+		var members []CategoryMember
+		err := client.CategoryMembers(category, p, 0, func(m CategoryMember) error {
+			members = append(members, m)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("CategoryMembers returned error: %v", err)
+		}
+		if len(members) != 3 || reqCount != 2 {
+			t.Fatalf("expected 3 members from 2 requests, got %d from %d", len(members), reqCount)
+		}
+		if m := members[1]; m.PageID != 2 || m.NS != 14 || m.Title != "Category:Bar" || m.Type != "subcat" {
+			t.Fatalf("unexpected member: %+v", m)
+		}
+	}
+
+	reqCount = 0
+	n := 0
+	err := client.CategoryMembers("Example", p, 1, func(m CategoryMember) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 1 || reqCount != 1 {
+		t.Fatalf("expected 1 member from 1 request, got %d from %d (err: %v)", n, reqCount, err)
+	}
+	if len(p) != 1 {
+		t.Fatalf("CategoryMembers modified p: %v", p)
+	}
+}
@@ -0,0 +1,133 @@
+package mwclient
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// DiffOp is the kind of change a DiffLine represents.
+type DiffOp uint8
+
+// These consts are the possible values of DiffOp.
+const (
+	// DiffContext means that the line is unchanged and is only included
+	// for context.
+	DiffContext DiffOp = iota
+	// DiffAdded means that the line was added or is the new version of
+	// a changed line.
+	DiffAdded
+	// DiffDeleted means that the line was deleted or is the old version of
+	// a changed line.
+	DiffDeleted
+)
+
+// DiffLine is a line of a diff between two revisions.
+type DiffLine struct {
+	Op DiffOp
+	// Text is the plain text of the line.
+	Text string
+	// Changes contains the text spans that were inserted (if Op is DiffAdded)
+	// or deleted (if Op is DiffDeleted) within the line, if the line is
+	// a changed line and not an entirely new or deleted line.
+	Changes []string
+}
+
+var (
+	diffRowRE    = regexp.MustCompile(`(?s)<tr[^>]*>(.*?)</tr>`)
+	diffCellRE   = regexp.MustCompile(`(?s)<td class="([^"]*)"[^>]*>(.*?)</td>`)
+	diffChangeRE = regexp.MustCompile(`(?s)<(?:ins|del)[^>]*>(.*?)</(?:ins|del)>`)
+	tagRE        = regexp.MustCompile(`<[^>]*>`)
+)
+
+// stripTags removes the HTML tags from s and unescapes any HTML entities.
+func stripTags(s string) string {
+	return html.UnescapeString(tagRE.ReplaceAllString(s, ""))
+}
+
+// CompareRevisions returns the diff between the revisions fromrev and torev
+// (action=compare) as a list of lines.
+// The diff is parsed from the HTML table returned by the API. The parsing is
+// best-effort: it supports the diff formats of current MediaWiki versions,
+// but lines in unrecognized formats are skipped.
+func (w *Client) CompareRevisions(fromrev, torev int) ([]DiffLine, error) {
+	p := params.Values{
+		"action":   "compare",
+		"fromrev":  strconv.Itoa(fromrev),
+		"torev":    strconv.Itoa(torev),
+		"prop":     "diff",
+		"difftype": "table",
+	}
+
+	resp, err := w.Get(p)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := resp.GetString("compare", "body")
+	if err != nil {
+		body, err = resp.GetString("compare", "*")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid API response: no diff body: %v", resp)
+	}
+
+	return parseDiff(body), nil
+}
+
+// parseDiff parses a diff in the HTML table format returned by action=compare.
+func parseDiff(body string) []DiffLine {
+	var lines []DiffLine
+	for _, row := range diffRowRE.FindAllStringSubmatch(body, -1) {
+		var deleted, added []DiffLine
+		var context *DiffLine
+		for _, cell := range diffCellRE.FindAllStringSubmatch(row[1], -1) {
+			class, content := cell[1], cell[2]
+
+			var op DiffOp
+			switch {
+			case strings.Contains(class, "diff-deletedline"),
+				strings.Contains(class, "diff-side-deleted"):
+				op = DiffDeleted
+			case strings.Contains(class, "diff-addedline"),
+				strings.Contains(class, "diff-side-added"):
+				op = DiffAdded
+			case strings.Contains(class, "diff-context"):
+				op = DiffContext
+			default:
+				// Markers, line numbers and empty cells.
+				continue
+			}
+
+			line := DiffLine{Op: op, Text: stripTags(content)}
+			if op != DiffContext {
+				for _, change := range diffChangeRE.FindAllStringSubmatch(content, -1) {
+					line.Changes = append(line.Changes, stripTags(change[1]))
+				}
+			}
+
+			switch op {
+			case DiffDeleted:
+				deleted = append(deleted, line)
+			case DiffAdded:
+				added = append(added, line)
+			case DiffContext:
+				// Context lines are shown on both sides of the diff.
+				if context == nil {
+					context = &line
+				}
+			}
+		}
+
+		if context != nil {
+			lines = append(lines, *context)
+		}
+		lines = append(lines, deleted...)
+		lines = append(lines, added...)
+	}
+	return lines
+}
@@ -0,0 +1,54 @@
+package mwclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCompareRevisions(t *testing.T) {
+	diff := `<tr><td colspan="2" class="diff-lineno">Line 1:</td><td colspan="2" class="diff-lineno">Line 1:</td></tr>
+<tr><td class="diff-marker"></td><td class="diff-context"><div>Unchanged &amp; kept</div></td><td class="diff-marker"></td><td class="diff-context"><div>Unchanged &amp; kept</div></td></tr>
+<tr><td class="diff-marker" data-marker="−"></td><td class="diff-deletedline diff-side-deleted"><div>The <del class="diffchange diffchange-inline">old</del> text</div></td><td class="diff-marker" data-marker="+"></td><td class="diff-addedline diff-side-added"><div>The <ins class="diffchange diffchange-inline">new</ins> text</div></td></tr>
+<tr><td colspan="2" class="diff-empty diff-side-deleted"></td><td class="diff-marker" data-marker="+"></td><td class="diff-addedline diff-side-added"><div>Added line</div></td></tr>`
+
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "compare" {
+			t.Fatalf("action != compare: action=%s", v)
+		}
+		if v := r.Form.Get("fromrev"); v != "1" {
+			t.Fatalf("fromrev != 1: fromrev=%s", v)
+		}
+		if v := r.Form.Get("torev"); v != "2" {
+			t.Fatalf("torev != 2: torev=%s", v)
+		}
+
+		b, _ := json.Marshal(diff)
+		fmt.Fprintf(w, `{"compare":{"fromrevid":1,"torevid":2,"body":%s}}`, b)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	lines, err := client.CompareRevisions(1, 2)
+	if err != nil {
+		t.Fatalf("CompareRevisions returned error: %v", err)
+	}
+
+	expected := []DiffLine{
+		{Op: DiffContext, Text: "Unchanged & kept"},
+		{Op: DiffDeleted, Text: "The old text", Changes: []string{"old"}},
+		{Op: DiffAdded, Text: "The new text", Changes: []string{"new"}},
+		{Op: DiffAdded, Text: "Added line"},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("lines != expected:\nlines=%#v\nexpected=%#v", lines, expected)
+	}
+}
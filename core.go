@@ -1,6 +1,12 @@
 package mwclient
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,8 +14,11 @@ import (
 	"net/http/cookiejar"
 	"net/http/httputil"
 	"net/url"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cgt.name/pkg/go-mwclient/params"
@@ -44,7 +53,8 @@ type (
 		UserAgent string
 		// API token cache.
 		// Maps from name of token (e.g., "csrf") to token value.
-		// Use GetToken to obtain tokens.
+		// Use GetToken to obtain tokens. Tokens must not be accessed
+		// directly while other goroutines are using the Client.
 		Tokens map[string]string
 		// Maxlag contains maxlag configuration for Client.
 		Maxlag Maxlag
@@ -52,8 +62,87 @@ type (
 		// the 'assert' parameter will be added to API requests with
 		// the value 'user' or 'bot', respectively. To disable such assertions,
 		// set Assert to AssertNone (set by default by New()).
+		// Requests whose assertion fails return an AssertionError.
 		Assert assertType
+		// If AssertUsername is non-empty, the 'assertuser' parameter will be
+		// added to API requests, causing them to fail with an AssertionError
+		// unless the client is logged in as the user named AssertUsername.
+		AssertUsername string
+		// If CaptchaSolver is non-nil, it is called by Edit and
+		// EditWithResult when an edit requires solving a CAPTCHA, and the edit
+		// is sent once more with the answer it returns. If it returns an
+		// error, the edit is not resent and the error is returned.
+		CaptchaSolver func(captcha CaptchaError) (answer string, err error)
+		// If RememberLogin is true, Login keeps the credentials it succeeded
+		// with in memory, so that WarmUp can log in again if the session has
+		// expired. By default, credentials are not kept.
+		RememberLogin bool
+		// If OnDeprecation is non-nil, it is called for each deprecation
+		// warning returned by the API, with the name of the module that
+		// returned the warning and the text of the warning. Deprecation
+		// warnings are still returned as APIWarnings.
+		OnDeprecation func(module, message string)
+		// If RequestIDs is true, a random UUID is sent with each request as
+		// the 'requestid' parameter. The API includes the ID in its response,
+		// and it is returned in the RequestID field of API errors, so that
+		// failed requests can be found in the server logs.
+		RequestIDs bool
+		// If DryRun is true, write methods (e.g., Edit, Undo, Watch, Purge)
+		// do not send their requests. Instead, the requests are logged to
+		// Logger, if any, and treated as if they succeeded.
+		// Other requests, including those made with Post, are sent as usual.
+		DryRun bool
+		// If ReadOnly is true, requests that would modify the wiki (see
+		// ErrReadOnly) are not sent, and ErrReadOnly is returned instead.
+		// Unlike DryRun, ReadOnly is enforced for all requests made through
+		// the client, including those made with Post.
+		ReadOnly bool
+		// If NormalizeContent is true, page content returned by methods such
+		// as GetPageByName, GetPageSlots, and GetRawWikitext is normalized:
+		// a leading byte order mark is removed, and Windows line endings are
+		// converted to Unix ones. By default, content is returned exactly as
+		// it is stored.
+		NormalizeContent bool
+		// Retries specifies how many times a GET request that fails because
+		// of a transient error, such as a network error or an HTTP 502 Bad
+		// Gateway response, is retried. The delay between attempts is set
+		// with SetBackoff. API errors are never retried. POST requests are only
+		// retried if they are sent with PostIdempotent, as other POST requests
+		// may have had an effect even if their response was not received.
+		// By default, requests are not retried.
+		Retries int
+		// If Logger is non-nil, the client logs requests that are retried or,
+		// in dry-run mode, not sent. A *log.Logger can be used as Logger.
+		// The client does not log anything by default.
+		Logger Logger
 		debug  io.Writer
+		cache  *responseCache
+		// limiter is set by SetRateLimit.
+		limiter *rateLimiter
+		// oauthToken is set by SetOAuthToken.
+		oauthToken string
+		// loginUsername and loginPassword are set by Login if RememberLogin
+		// is true.
+		loginUsername, loginPassword string
+		// sleep is used for mocking sleepContext in tests.
+		sleep sleeper
+		// backoff is set by SetBackoff.
+		backoff Backoff
+		// done is closed by Close to stop background goroutines,
+		// which are tracked by bg.
+		done      chan struct{}
+		closeOnce sync.Once
+		bg        sync.WaitGroup
+		// tokenFlight deduplicates concurrent token requests.
+		tokenFlight flightGroup
+		// tokensMu guards Tokens.
+		tokensMu sync.RWMutex
+		// cacheStatus is the CDN cache status of the last response.
+		cacheStatus   string
+		cacheStatusMu sync.Mutex
+		// namespaces is cached by namespaceInfo.
+		namespaces   *namespaceInfo
+		namespacesMu sync.Mutex
 	}
 
 	// Maxlag contains maxlag configuration for Client.
@@ -61,11 +150,16 @@ type (
 	Maxlag struct {
 		// If true, API requests will set the maxlag parameter.
 		On bool
+		// If true (and On is true), the maxlag parameter will only be set on
+		// POST requests, which includes all write requests. This avoids
+		// delaying reads, which do not add to the load on database replicas
+		// that maxlag is meant to protect.
+		WritesOnly bool
 		// The maxlag parameter to send to the server.
 		Timeout string
 		// Specifies how many times to retry a request before returning with an error.
 		Retries int
-		// sleep is used for mocking time.Sleep in tests to avoid prolonging
+		// sleep is used for mocking sleepContext in tests to avoid prolonging
 		// test execution needlessly by actually sleeping.
 		sleep sleeper
 	}
@@ -74,20 +168,158 @@ type (
 // SetDebug takes an io.Writer to which HTTP requests and responses
 // made by Client will be dumped with httputil to as they are sent and
 // received. To disable, set to nil (default).
+// Passwords, tokens (in requests and in responses), and authentication
+// headers (Authorization, Cookie, and Set-Cookie) are replaced with
+// "[REDACTED]" in the dumps, so that they can be shared when reporting
+// problems.
 func (w *Client) SetDebug(wr io.Writer) { w.debug = wr }
 
+// redactedParams are the parameters whose values are redacted in the dumps
+// written to the SetDebug writer.
+var redactedParams = []string{"lgpassword", "lgtoken", "password", "retype", "logintoken", "token"}
+
+var (
+	redactedParamsRE = regexp.MustCompile(`(^|[?&\s])(` + strings.Join(redactedParams, "|") +
+		`)=[^&\s]*`)
+	redactedFormDataRE = regexp.MustCompile(`(name="(?:` + strings.Join(redactedParams, "|") +
+		`)"\r?\n\r?\n)[^\r\n]*`)
+	redactedHeadersRE = regexp.MustCompile(`(?mi)^(Authorization|Cookie|Set-Cookie):.*$`)
+	// redactedTokensRE matches tokens in responses to meta=tokens.
+	redactedTokensRE = regexp.MustCompile(`("[a-z]*token"\s*:\s*")[^"]*"`)
+)
+
+// redactDump replaces the sensitive parameter values and headers in the HTTP
+// request or response dump with "[REDACTED]".
+func redactDump(dump []byte) []byte {
+	dump = redactedParamsRE.ReplaceAll(dump, []byte("$1$2=[REDACTED]"))
+	dump = redactedFormDataRE.ReplaceAll(dump, []byte("$1[REDACTED]"))
+	dump = redactedTokensRE.ReplaceAll(dump, []byte(`$1[REDACTED]"`))
+	return redactedHeadersRE.ReplaceAll(dump, []byte("$1: [REDACTED]"))
+}
+
+// SetUserAgent sets the HTTP User-Agent of the client to userAgent joined with
+// DefaultUserAgent, like New does. userAgent should identify the application
+// and include contact information, as required by the User-Agent policy of
+// many wikis (e.g., https://meta.wikimedia.org/wiki/User-Agent_policy).
+// SetUserAgent returns an error if userAgent is empty, and logs a warning to
+// Client.Logger if it is DefaultUserAgent.
+func (w *Client) SetUserAgent(userAgent string) error {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return errors.New("empty User-Agent")
+	}
+	if userAgent == DefaultUserAgent {
+		w.logf("mwclient: User-Agent %q does not identify the application", userAgent)
+		w.UserAgent = userAgent
+		return nil
+	}
+	w.UserAgent = userAgent + " " + DefaultUserAgent
+	return nil
+}
+
 // SetHTTPTimeout overrides the default HTTP client timeout of 30 seconds.
 // This is not related to the maxlag timeout.
 func (w *Client) SetHTTPTimeout(timeout time.Duration) {
 	w.httpc.Timeout = timeout
 }
 
-// sleeper is used for mocking time.Sleep.
-type sleeper func(d time.Duration)
+// SetHTTPClient makes the client send requests with a copy of the HTTP
+// client c, e.g. to use a proxy or a custom TLS configuration. c itself is not
+// modified, and changing it afterwards has no effect. If c has no cookie jar,
+// the client's cookie jar is used so that the session is kept, and if c has
+// no redirect policy, the one set with SetMaxRedirects is kept.
+// SetHTTPClient must be called before OAuth, which replaces the HTTP client.
+func (w *Client) SetHTTPClient(c *http.Client) {
+	httpc := *c
+	if httpc.Jar == nil {
+		httpc.Jar = w.httpc.Jar
+	}
+	if httpc.CheckRedirect == nil {
+		httpc.CheckRedirect = w.httpc.CheckRedirect
+	}
+	w.httpc = &httpc
+}
+
+// LastCacheStatus returns the CDN cache status of the last response received
+// from the API, as reported by the X-Cache-Status header or, if it is not
+// set, the X-Cache header (e.g., "hit-front" or "cp3066 miss, cp3066 pass").
+// It returns an empty string if the response had neither header, e.g. because
+// the wiki is not behind a CDN. Responses served from the cache enabled with
+// SetCache do not change the status.
+func (w *Client) LastCacheStatus() string {
+	w.cacheStatusMu.Lock()
+	defer w.cacheStatusMu.Unlock()
+	return w.cacheStatus
+}
+
+// SetMaxRedirects sets the maximum amount of HTTP redirects that will be
+// followed for a single request. If n is 0, redirects are not followed and
+// requests to a URL that redirects will return an error. This is useful for
+// detecting a misconfigured API URL. If n is negative, the default policy of
+// net/http (follow up to 10 redirects) is restored.
+func (w *Client) SetMaxRedirects(n int) {
+	switch {
+	case n < 0:
+		w.httpc.CheckRedirect = nil
+	case n == 0:
+		w.httpc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	default:
+		w.httpc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= n {
+				return fmt.Errorf("stopped after %d redirects", n)
+			}
+			return nil
+		}
+	}
+}
+
+// newRequestID returns a random (version 4) UUID for use as a request ID.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Should never happen. Request IDs are only used for debugging,
+		// so fall back to the current time.
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Logger is the interface used by Client for logging. See Client.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logf logs a message to w.Logger if it is set.
+func (w *Client) logf(format string, v ...interface{}) {
+	if w.Logger != nil {
+		w.Logger.Printf(format, v...)
+	}
+}
+
+// sleeper is used for mocking sleepContext.
+type sleeper func(ctx context.Context, d time.Duration) error
+
+// sleepContext waits for the duration d. If ctx is canceled before d has
+// passed, it returns ctx.Err() immediately.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
 
 // New returns a pointer to an initialized Client object. If the provided API URL
 // is invalid (as defined by the net/url package), then it will return nil and
-// the error from url.Parse().
+// the error from url.Parse(). If the URL is not absolute (e.g., "api.php"),
+// New returns nil and an error as well.
 //
 // The userAgent parameter will be joined with the DefaultUserAgent const and
 // used as HTTP User-Agent. If userAgent is an empty string, DefaultUserAgent
@@ -107,6 +339,9 @@ func New(inURL, userAgent string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if apiurl.Scheme == "" || apiurl.Host == "" {
+		return nil, fmt.Errorf("API URL %q must be an absolute URL with a scheme and host", inURL)
+	}
 
 	var ua string
 	if userAgent != "" {
@@ -129,42 +364,168 @@ func New(inURL, userAgent string) (*Client, error) {
 			On:      false,
 			Timeout: "5",
 			Retries: 3,
-			sleep:   time.Sleep,
+			sleep:   sleepContext,
 		},
 		Assert: AssertNone,
+		sleep:  sleepContext,
+		done:   make(chan struct{}),
 	}, nil
 }
 
+// Close stops any background goroutines started by the client, waits for
+// them to finish, and closes idle HTTP connections. The client should not be
+// used after calling Close. Calling Close more than once has no effect.
+func (w *Client) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.bg.Wait()
+		w.httpc.CloseIdleConnections()
+	})
+	return nil
+}
+
+// background runs f in a new goroutine that Close waits for.
+// The channel passed to f is closed when Close is called, and f should
+// return soon after that.
+func (w *Client) background(f func(done <-chan struct{})) {
+	w.bg.Add(1)
+	go func() {
+		defer w.bg.Done()
+		f(w.done)
+	}()
+}
+
+// callOptions modifies how a single request is made by callWithOptions.
+type callOptions struct {
+	// If true, the request will be POSTed instead of sent as a GET request.
+	post bool
+	// If true, the response cache is bypassed.
+	fresh bool
+	// If true, the response is not served from the cache, but stored in it.
+	revalidate bool
+	// If body is non-nil, the request is POSTed with body as its body and
+	// contentType as its Content-Type, and the parameters are sent in the
+	// URL query string.
+	body        []byte
+	contentType string
+	// bodyReader is like body, but is streamed to the server. Because it can
+	// only be read once, maxlag is not used for such requests.
+	bodyReader io.Reader
+	// ctx is the context of the request. If nil, context.Background() is used.
+	ctx context.Context
+	// If true, the request is retried on transient errors (see Client.Retries)
+	// even if it is POSTed.
+	idempotent bool
+	// If true, the request is not retried on transient errors regardless of
+	// Client.Retries, e.g. because the caller retries it itself.
+	noRetry bool
+	// If true, the assertions configured on the client (Client.Assert and
+	// Client.AssertUsername) are not added to the request.
+	noAssert bool
+	// If true, the request is sent to index.php instead of the API, and p is
+	// sent as is, without format, assertion or maxlag parameters. Such
+	// requests are not cached.
+	indexPHP bool
+}
+
 // call makes a GET or POST request to the Mediawiki API depending on whether
 // the post argument is true or false (if true, it will POST) and returns
 // the response body as an io.ReadCloser. Remember to close it when done with it.
 // call supports the maxlag parameter and will respect it if it is turned on
 // in the Client it operates on.
 func (w *Client) call(p params.Values, post bool) (io.ReadCloser, error) {
+	return w.callWithOptions(p, callOptions{post: post})
+}
+
+// ErrReadOnly is returned instead of sending a request that would modify the
+// wiki when Client.ReadOnly is true. A request is considered to modify the
+// wiki if its action is one of writeActions, if it is POSTed with a 'token'
+// parameter, or if it has a request body (see Client.PostBody) and its action
+// is not given in the URL query string.
+var ErrReadOnly = errors.New("client is read-only")
+
+// writeActions are the API and index.php actions that modify the wiki.
+var writeActions = map[string]bool{
+	"block":                    true,
+	"changecontentmodel":       true,
+	"changeauthenticationdata": true,
+	"createaccount":            true,
+	"delete":                   true,
+	"deleteglobalaccount":      true,
+	"echomarkread":             true,
+	"edit":                     true,
+	"emailuser":                true,
+	"filerevert":               true,
+	"imagerotate":              true,
+	"import":                   true,
+	"managetags":               true,
+	"mergehistory":             true,
+	"move":                     true,
+	"options":                  true,
+	"patrol":                   true,
+	"protect":                  true,
+	"purge":                    true,
+	"removeauthenticationdata": true,
+	"resetpassword":            true,
+	"review":                   true,
+	"revisiondelete":           true,
+	"rollback":                 true,
+	"setglobalaccountstatus":   true,
+	"setnotificationtimestamp": true,
+	"setpagelanguage":          true,
+	"stabilize":                true,
+	"submit":                   true,
+	"tag":                      true,
+	"thank":                    true,
+	"unblock":                  true,
+	"undelete":                 true,
+	"upload":                   true,
+	"userrights":               true,
+	"watch":                    true,
+}
+
+// callWithOptions is like call, but takes a callOptions instead of a bool.
+func (w *Client) callWithOptions(p params.Values, opts callOptions) (io.ReadCloser, error) {
+	hasBody := opts.body != nil || opts.bodyReader != nil
+	post := opts.post || hasBody
+	if w.ReadOnly && (writeActions[p.Get("action")] || post && p.Get("token") != "" ||
+		hasBody && p.Get("action") == "") {
+		w.logf("mwclient: read-only: not sending request: %s", p.Encode())
+		return nil, ErrReadOnly
+	}
+	cache := w.cache
+	if post || opts.fresh || opts.indexPHP {
+		cache = nil
+	}
+	maxlag := w.Maxlag.On && (post || !w.Maxlag.WritesOnly) && opts.bodyReader == nil && !opts.indexPHP
+	endpoint := w.apiURL.String()
+	if opts.indexPHP {
+		endpoint = w.indexURL()
+	}
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	// The main functionality in this method is in a closure to simplify maxlag handling.
 	callf := func() (io.ReadCloser, error) {
-		p.Set("format", "json")
-		if fmtver := p.Get("formatversion"); fmtver == "1" {
-			p.Set("utf8", "")
-		} else if fmtver == "" {
-			p.Set("formatversion", "2")
-			// utf8= is implicit in formatversion=2
+		if !opts.indexPHP {
+			w.setAPIParams(p, maxlag, !opts.noAssert)
 		}
 
-		if w.Maxlag.On {
-			if p.Get("maxlag") == "" {
-				// User has not set maxlag param manually. Use configured value.
-				p.Set("maxlag", w.Maxlag.Timeout)
-			}
-		}
-
-		if w.Assert > AssertNone {
-			switch w.Assert {
-			case AssertUser:
-				p.Set("assert", "user")
-			case AssertBot:
-				p.Set("assert", "bot")
+		var cacheKey, etag string
+		var cached []byte
+		if cache != nil {
+			cacheKey = p.Encode()
+			if !opts.revalidate {
+				if body, revalidate, ok := cache.lookup(cacheKey); ok {
+					if revalidate {
+						w.revalidate(cacheKey, p)
+					}
+					return ioutil.NopCloser(bytes.NewReader(body)), nil
+				}
 			}
+			cached, etag = cache.validator(cacheKey)
 		}
 
 		// Make a POST or GET request depending on the "post" parameter.
@@ -175,12 +536,27 @@ func (w *Client) call(p params.Values, post bool) (io.ReadCloser, error) {
 			httpMethod = "GET"
 		}
 
+		// The request ID is added after the cache key has been computed,
+		// and is not stored in p so that p can be reused.
+		query := p.Encode()
+		var requestID string
+		if w.RequestIDs && !opts.indexPHP {
+			requestID = newRequestID()
+			query += "&requestid=" + requestID
+		}
+
 		var req *http.Request
 		var err error
-		if post {
-			req, err = http.NewRequest(httpMethod, w.apiURL.String(), strings.NewReader(p.Encode()))
+		if hasBody {
+			body := opts.bodyReader
+			if opts.body != nil {
+				body = bytes.NewReader(opts.body)
+			}
+			req, err = http.NewRequestWithContext(ctx, httpMethod, fmt.Sprintf("%s?%s", endpoint, query), body)
+		} else if post {
+			req, err = http.NewRequestWithContext(ctx, httpMethod, endpoint, strings.NewReader(query))
 		} else {
-			req, err = http.NewRequest(httpMethod, fmt.Sprintf("%s?%s", w.apiURL.String(), p.Encode()), nil)
+			req, err = http.NewRequestWithContext(ctx, httpMethod, fmt.Sprintf("%s?%s", endpoint, query), nil)
 		}
 		if err != nil {
 			return nil, fmt.Errorf("unable to create HTTP request (method: %s, params: %v): %v",
@@ -189,78 +565,303 @@ func (w *Client) call(p params.Values, post bool) (io.ReadCloser, error) {
 
 		// Set headers on request
 		req.Header.Set("User-Agent", w.UserAgent)
-		if post {
+		req.Header.Set("Accept-Encoding", "gzip")
+		if w.oauthToken != "" {
+			req.Header.Set("Authorization", "Bearer "+w.oauthToken)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if hasBody {
+			req.Header.Set("Content-Type", opts.contentType)
+		} else if post {
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		}
 
+		if err := w.waitRateLimit(ctx); err != nil {
+			return nil, err
+		}
+
 		if w.debug != nil {
 			reqdump, err := httputil.DumpRequestOut(req, true)
 			if err != nil {
 				fmt.Fprintf(w.debug, "Err dumping request: %v\n", err)
 			} else {
-				w.debug.Write(reqdump)
+				w.debug.Write(redactDump(reqdump))
 			}
 		}
 
 		// Make the request
 		resp, err := w.httpc.Do(req)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if requestID != "" {
+				return nil, fmt.Errorf("error occured during HTTP request (request ID %s): %v", requestID, err)
+			}
 			return nil, fmt.Errorf("error occured during HTTP request: %v", err)
 		}
+		if err := decompressBody(resp); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unable to decompress response: %v", err)
+		}
+
+		cacheStatus := resp.Header.Get("X-Cache-Status")
+		if cacheStatus == "" {
+			cacheStatus = resp.Header.Get("X-Cache")
+		}
+		w.cacheStatusMu.Lock()
+		w.cacheStatus = cacheStatus
+		w.cacheStatusMu.Unlock()
 
 		if w.debug != nil {
 			respdump, err := httputil.DumpResponse(resp, true)
 			if err != nil {
 				fmt.Fprintf(w.debug, "Err dumping response: %v\n", err)
 			} else {
-				w.debug.Write(respdump)
+				w.debug.Write(redactDump(respdump))
 			}
 		}
 
-		// Handle maxlag
-		if resp.Header.Get("X-Database-Lag") != "" {
+		// Redirects are only returned here if they were not followed
+		// (see SetMaxRedirects).
+		if loc := resp.Header.Get("Location"); loc != "" &&
+			resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("API URL redirects to %s (HTTP status %s)", loc, resp.Status)
+		}
+
+		// Handle maxlag. Servers that are overloaded for other reasons
+		// respond with 503 Service Unavailable, which is retried the same way.
+		if resp.Header.Get("X-Database-Lag") != "" ||
+			maxlag && resp.StatusCode == http.StatusServiceUnavailable {
 			defer resp.Body.Close()
-			retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				return nil, err
 			}
 
+			return nil, maxLagError{
+				string(body),
+				retryAfter(resp.Header, time.Now()),
+			}
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 &&
+			!(etag != "" && resp.StatusCode == http.StatusNotModified) {
+			defer resp.Body.Close()
+			return nil, newHTTPError(resp)
+		}
+
+		if cache != nil {
+			defer resp.Body.Close()
+			if etag != "" && resp.StatusCode == http.StatusNotModified {
+				cache.add(cacheKey, cached, etag)
+				return ioutil.NopCloser(bytes.NewReader(cached)), nil
+			}
 			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				return nil, err
 			}
-
-			return nil, maxLagError{
-				string(body),
-				retryAfter,
+			if cacheable(body) {
+				cache.add(cacheKey, body, resp.Header.Get("ETag"))
 			}
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
 		}
 
 		return resp.Body, nil
 	}
 
-	if w.Maxlag.On {
-		for tries := 0; tries < w.Maxlag.Retries; tries++ {
-			reqResp, err := callf()
+	// attempt makes the request once, waiting and retrying as long as the
+	// server is lagged if maxlag is enabled.
+	attempt := func() (io.ReadCloser, error) {
+		if maxlag {
+			for tries := 0; tries < w.Maxlag.Retries; tries++ {
+				reqResp, err := callf()
 
-			// Logic for handling maxlag errors. If err is nil or a different error,
-			// they are passed through in the else.
-			if lagerr, ok := err.(maxLagError); ok {
-				// If there are no tries left, don't wait needlessly.
-				if tries < w.Maxlag.Retries-1 {
-					w.Maxlag.sleep(time.Duration(lagerr.Wait) * time.Second)
+				// Logic for handling maxlag errors. If err is nil or a different error,
+				// they are passed through in the else.
+				if lagerr, ok := err.(maxLagError); ok {
+					// If there are no tries left, don't wait needlessly.
+					if tries < w.Maxlag.Retries-1 {
+						w.logf("mwclient: %s; retrying in %d seconds", strings.TrimSpace(lagerr.Message), lagerr.Wait)
+						if err := w.Maxlag.sleep(ctx, time.Duration(lagerr.Wait)*time.Second); err != nil {
+							return nil, err
+						}
+					}
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					continue
+				} else {
+					return reqResp, err
 				}
-				continue
-			} else {
-				return reqResp, err
 			}
+
+			return nil, ErrAPIBusy
 		}
 
-		return nil, ErrAPIBusy
+		// If maxlag is not enabled, just do the request regularly.
+		return callf()
 	}
 
-	// If maxlag is not enabled, just do the request regularly.
-	return callf()
+	// Transient errors are only retried for requests that are safe to repeat.
+	retries := w.Retries
+	if post && !opts.idempotent || opts.bodyReader != nil || opts.noRetry {
+		retries = 0
+	}
+	resp, err := attempt()
+	for try := 1; try <= retries && isTransient(err) && ctx.Err() == nil; try++ {
+		delay := w.retryDelay(try)
+		w.logf("mwclient: request failed: %v; retrying in %s", err, delay)
+		if err := w.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		resp, err = attempt()
+	}
+	if post && !opts.idempotent && err == nil {
+		// The request may have changed the wiki, so cached responses (e.g.
+		// of the page that was edited) may be outdated.
+		w.clearCache()
+	}
+	return resp, err
+}
+
+// setAPIParams sets the parameters that callWithOptions adds to every API
+// request: the response format and, if maxlag and assert are true, the maxlag
+// parameter and the assertions configured on the client.
+func (w *Client) setAPIParams(p params.Values, maxlag, assert bool) {
+	p.Set("format", "json")
+	if fmtver := p.Get("formatversion"); fmtver == "1" {
+		p.Set("utf8", "")
+	} else if fmtver == "" {
+		p.Set("formatversion", "2")
+		// utf8= is implicit in formatversion=2
+	}
+
+	if maxlag {
+		if p.Get("maxlag") == "" {
+			// User has not set maxlag param manually. Use configured value.
+			p.Set("maxlag", w.Maxlag.Timeout)
+		}
+	}
+
+	if !assert {
+		return
+	}
+	if w.Assert > AssertNone {
+		switch w.Assert {
+		case AssertUser:
+			p.Set("assert", "user")
+		case AssertBot:
+			p.Set("assert", "bot")
+		}
+	}
+	if w.AssertUsername != "" {
+		p.Set("assertuser", w.AssertUsername)
+	}
+}
+
+// indexURL returns the URL of index.php, which is assumed to be in the same
+// directory as the API URL (e.g., https://en.wikipedia.org/w/index.php).
+func (w *Client) indexURL() string {
+	u := *w.apiURL
+	u.Path = path.Join(path.Dir(u.Path), "index.php")
+	u.RawQuery = ""
+	return u.String()
+}
+
+// newHTTPError creates an HTTPError from the non-2xx response resp.
+func newHTTPError(resp *http.Response) HTTPError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, httpErrorBodyLimit))
+	e := HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       strings.TrimSpace(string(body)),
+	}
+	if resp.Header.Get("Retry-After") != "" {
+		e.RetryAfter = retryAfter(resp.Header, time.Now())
+	}
+	return e
+}
+
+// gzipBody is the body of a gzip-compressed response. Closing it closes both
+// the gzip reader and the underlying body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// decompressBody replaces the body of resp with a decompressing reader if the
+// server compressed it with gzip. Responses that are not compressed, e.g.
+// because the server ignored the Accept-Encoding header, are left alone.
+func decompressBody(resp *http.Response) error {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err == io.EOF {
+		// Empty body, e.g. 304 Not Modified.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	resp.Body = gzipBody{zr, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// defaultRetryAfter is the amount of seconds to wait before retrying
+// a request that failed because of lag if the server did not say how long
+// to wait.
+const defaultRetryAfter = 5
+
+// retryAfter returns the amount of seconds to wait according to the
+// Retry-After header in h, which may be an amount of seconds or an HTTP date.
+func retryAfter(h http.Header, now time.Time) int {
+	v := h.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return secs
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return int((d + time.Second - 1) / time.Second)
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+// revalidate updates the cache entry for key, an expired response to
+// a request with the parameters p, by making the request again in
+// a background goroutine. See SetStaleWhileRevalidate.
+func (w *Client) revalidate(key string, p params.Values) {
+	// p may be modified by the caller after revalidate returns.
+	pc := make(params.Values, len(p))
+	for k, v := range p {
+		pc[k] = v
+	}
+
+	cache := w.cache
+	// The request is a single one, so Close waits for it to finish
+	// instead of cancelling it.
+	w.background(func(<-chan struct{}) {
+		body, err := w.callWithOptions(pc, callOptions{revalidate: true})
+		if err != nil {
+			cache.cancelRevalidation(key)
+			return
+		}
+		body.Close()
+	})
 }
 
 // callJSON wraps the call method and encodes the JSON response
@@ -269,7 +870,12 @@ func (w *Client) call(p params.Values, post bool) (io.ReadCloser, error) {
 // during the API call or the parsing of the JSON response, in which case that
 // error will be returned and the *jason.Object return value will be nil).
 func (w *Client) callJSON(p params.Values, post bool) (*jason.Object, error) {
-	body, err := w.call(p, post)
+	return w.callJSONWithOptions(p, callOptions{post: post})
+}
+
+// callJSONWithOptions is like callJSON, but takes a callOptions instead of a bool.
+func (w *Client) callJSONWithOptions(p params.Values, opts callOptions) (*jason.Object, error) {
+	body, err := w.callWithOptions(p, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -282,7 +888,11 @@ func (w *Client) callJSON(p params.Values, post bool) (*jason.Object, error) {
 		return nil, err
 	}
 
-	return js, extractAPIErrors(js)
+	err = extractAPIErrors(js)
+	if warnings, ok := err.(APIWarnings); ok && w.OnDeprecation != nil {
+		reportDeprecations(warnings, w.OnDeprecation)
+	}
+	return js, err
 }
 
 // callRaw wraps the call method and reads the response body into a []byte.
@@ -307,10 +917,35 @@ func (w *Client) callRaw(p params.Values, post bool) ([]byte, error) {
 // response as a *jason.Object.
 // Get will return any API errors and/or warnings (if no other errors occur)
 // as the error return value.
+// A plain map[string]string can be passed as p, as params.Values is one.
 func (w *Client) Get(p params.Values) (*jason.Object, error) {
 	return w.callJSON(p, false)
 }
 
+// GetCtx is like Get, but the request is made with the context ctx.
+// If ctx is canceled or its deadline expires before the response has been
+// received, including while waiting to retry the request, GetCtx returns
+// ctx.Err().
+func (w *Client) GetCtx(ctx context.Context, p params.Values) (*jason.Object, error) {
+	return w.callJSONWithOptions(p, callOptions{ctx: ctx})
+}
+
+// GetWithTimeout is like Get, but the request fails with
+// context.DeadlineExceeded if no response has been received within timeout,
+// including any time spent waiting to retry the request. The timeout only
+// applies to this request; the timeout of the HTTP client still applies too.
+func (w *Client) GetWithTimeout(p params.Values, timeout time.Duration) (*jason.Object, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return w.GetCtx(ctx, p)
+}
+
+// GetFresh is like Get, but the request is always sent to the API even if
+// an identical request has a response in the cache. See SetCache.
+func (w *Client) GetFresh(p params.Values) (*jason.Object, error) {
+	return w.callJSONWithOptions(p, callOptions{fresh: true})
+}
+
 // GetRaw performs a GET request with the specified parameters
 // and returns the raw JSON response as a []byte.
 // Unlike Get, GetRaw does not check for API errors/warnings.
@@ -320,14 +955,89 @@ func (w *Client) GetRaw(p params.Values) ([]byte, error) {
 	return w.callRaw(p, false)
 }
 
+// GetInto performs a GET request with the specified parameters and decodes
+// the JSON response into the value pointed to by v using encoding/json, so
+// that the response can be read through a struct of the expected shape.
+// The response is checked for API errors before it is decoded: if it contains
+// an error, the error is returned and v is not modified. As with Get, API
+// warnings are returned as the error value, after v has been filled in.
+func (w *Client) GetInto(p params.Values, v interface{}) error {
+	body, err := w.callRaw(p, false)
+	if err != nil {
+		return err
+	}
+
+	js, err := jason.NewObjectFromBytes(body)
+	if err != nil {
+		return err
+	}
+	apierr := extractAPIErrors(js)
+	warnings, ok := apierr.(APIWarnings)
+	if apierr != nil && !ok {
+		return apierr
+	}
+	if ok && w.OnDeprecation != nil {
+		reportDeprecations(warnings, w.OnDeprecation)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unable to decode API response: %v", err)
+	}
+	return apierr
+}
+
 // Post performs a POST request with the specified parameters and returns the
 // response as a *jason.Object.
 // Post will return any API errors and/or warnings (if no other errors occur)
 // as the error return value.
+// A plain map[string]string can be passed as p, as params.Values is one.
 func (w *Client) Post(p params.Values) (*jason.Object, error) {
 	return w.callJSON(p, true)
 }
 
+// PostCtx is like Post, but the request is made with the context ctx.
+// If ctx is canceled or its deadline expires before the response has been
+// received, PostCtx returns ctx.Err().
+func (w *Client) PostCtx(ctx context.Context, p params.Values) (*jason.Object, error) {
+	return w.callJSONWithOptions(p, callOptions{post: true, ctx: ctx})
+}
+
+// PostWithTimeout is like Post, but the request fails with
+// context.DeadlineExceeded if no response has been received within timeout.
+// As with PostCtx, the request may have been processed by the server even
+// if it timed out.
+func (w *Client) PostWithTimeout(p params.Values, timeout time.Duration) (*jason.Object, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return w.PostCtx(ctx, p)
+}
+
+// PostBody performs a POST request with body as the request body and
+// contentType as its Content-Type, and returns the response as
+// a *jason.Object. The parameters p are sent in the URL query string.
+// PostBody is useful for requests whose body cannot be encoded from
+// a params.Values, e.g. already encoded multipart/form-data bodies.
+// body is read completely before the request is sent.
+// PostBody will return any API errors and/or warnings (if no other errors
+// occur) as the error return value.
+func (w *Client) PostBody(contentType string, body io.Reader, p params.Values) (*jason.Object, error) {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		b = []byte{}
+	}
+	return w.callJSONWithOptions(p, callOptions{body: b, contentType: contentType})
+}
+
+// PostIdempotent is like Post, but the request is retried on transient errors
+// as specified by Client.Retries. It must only be used for requests that can
+// safely be repeated, e.g. queries that are POSTed because of their length.
+func (w *Client) PostIdempotent(p params.Values) (*jason.Object, error) {
+	return w.callJSONWithOptions(p, callOptions{post: true, idempotent: true})
+}
+
 // PostRaw performs a POST request with the specified parameters
 // and returns the raw JSON response as a []byte.
 // Unlike Post, PostRaw does not check for API errors/warnings.
@@ -338,9 +1048,17 @@ func (w *Client) PostRaw(p params.Values) ([]byte, error) {
 }
 
 // Login attempts to login using the provided username and password.
-// Do not use Login with OAuth.
+// Login is intended for BotPasswords (Special:BotPasswords), in which case
+// username is the account name followed by "@" and the bot name
+// (e.g., "Example@MyBot"). Use ClientLogin to log in with the main password
+// of an account. Do not use Login with OAuth.
 func (w *Client) Login(username, password string) error {
-	token, err := w.GetToken(LoginToken)
+	return w.login(username, password, callOptions{})
+}
+
+// login is like Login, but makes the requests with the options opts.
+func (w *Client) login(username, password string, opts callOptions) error {
+	token, err := w.fetchToken(LoginToken, opts)
 	if err != nil {
 		return err
 	}
@@ -350,7 +1068,8 @@ func (w *Client) Login(username, password string) error {
 		"lgpassword": password,
 		"lgtoken":    token,
 	}
-	resp, err := w.Post(v)
+	opts.post = true
+	resp, err := w.callJSONWithOptions(v, opts)
 	if err != nil {
 		return err
 	}
@@ -365,15 +1084,129 @@ func (w *Client) Login(username, password string) error {
 		}
 		return apierr
 	}
+	// Responses cached and tokens obtained before the login were made
+	// anonymously or as another user.
+	w.clearCache()
+	w.ClearTokens()
+	if w.RememberLogin {
+		w.loginUsername, w.loginPassword = username, password
+	}
+	return nil
+}
+
+// ErrNotLoggedIn is returned by Client.WarmUp and methods that require
+// a logged-in user (e.g., Client.Watchlist) when the client is not logged in.
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// WarmUp makes a request for information about the current user to check
+// that the API is reachable and that the session is still valid, and to
+// open a connection to the server for the requests that follow. It is meant to
+// be called before a long run of requests.
+// If the session has expired (i.e., the request is made anonymously, or an
+// assertion set with Client.Assert fails) and the client has logged in with
+// RememberLogin set, WarmUp logs in again. If the session cannot be restored,
+// ErrNotLoggedIn or the error of the login is returned.
+func (w *Client) WarmUp() error {
+	anon, err := w.sessionAnonymous()
+	if _, ok := err.(AssertionError); !ok && (err != nil || !anon) {
+		return err
+	}
+	if w.loginUsername == "" {
+		// Either the client is not expected to be logged in, or there are
+		// no credentials to log in again with.
+		return err
+	}
+
+	w.logf("mwclient: session expired; logging in again as %s", w.loginUsername)
+	// The assertions would fail until the login has succeeded. login also
+	// clears the response cache and the tokens of the old session.
+	if err := w.login(w.loginUsername, w.loginPassword, callOptions{noAssert: true}); err != nil {
+		return err
+	}
+
+	anon, err = w.sessionAnonymous()
+	if err == nil && anon {
+		return ErrNotLoggedIn
+	}
+	return err
+}
+
+// sessionAnonymous reports whether requests are made anonymously, i.e. the
+// client is not logged in.
+func (w *Client) sessionAnonymous() (bool, error) {
+	resp, err := w.GetFresh(params.Values{"action": "query", "meta": "userinfo"})
+	if resp == nil {
+		return false, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return false, err
+	}
+	anon, _ := resp.GetBoolean("query", "userinfo", "anon")
+	return anon, err
+}
+
+// ClientLogin logs in with the main password of an account, using
+// action=clientlogin. If the login fails or requires further steps that
+// ClientLogin does not support (e.g., two-factor authentication or
+// a captcha), an APIError is returned whose Code is the message code
+// returned by the API (or the login status if there is none), and whose
+// Info is the message. Do not use ClientLogin with OAuth.
+func (w *Client) ClientLogin(username, password string) error {
+	token, err := w.GetToken(LoginToken)
+	if err != nil {
+		return err
+	}
+	v := params.Values{
+		"action":         "clientlogin",
+		"username":       username,
+		"password":       password,
+		"logintoken":     token,
+		"loginreturnurl": w.apiURL.String(),
+	}
+	resp, err := w.Post(v)
+	if err != nil {
+		return err
+	}
+
+	var r struct {
+		ClientLogin struct {
+			Status      string `json:"status"`
+			Message     string `json:"message"`
+			MessageCode string `json:"messagecode"`
+		} `json:"clientlogin"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return err
+	}
+	result := r.ClientLogin
+	if result.Status == "" {
+		return fmt.Errorf("invalid API response: no clientlogin status: %v", resp)
+	}
+	if result.Status != "PASS" {
+		apierr := APIError{Code: result.MessageCode, Info: result.Message}
+		if apierr.Code == "" {
+			apierr.Code = result.Status
+		}
+		return apierr
+	}
+	w.clearCache()
+	w.ClearTokens()
 	return nil
 }
 
 // Logout sends a logout request to the API.
 // Logout does not take into account whether or not a user is actually logged in.
+// Credentials kept because of RememberLogin are forgotten.
 // Do not use Logout with OAuth.
 func (w *Client) Logout() error {
-	_, err := w.GetRaw(params.Values{"action": "logout"})
-	return err
+	w.loginUsername, w.loginPassword = "", ""
+	body, err := w.callWithOptions(params.Values{"action": "logout"}, callOptions{fresh: true})
+	w.clearCache()
+	w.ClearTokens()
+	if err != nil {
+		return err
+	}
+	return body.Close()
 }
 
 // OAuth configures OAuth authentication. After calling OAuth, future requests
@@ -392,7 +1225,24 @@ func (w *Client) OAuth(consumerToken, consumerSecret, accessToken, accessSecret
 		return err
 	}
 	httpc.Jar = w.httpc.Jar
+	httpc.CheckRedirect = w.httpc.CheckRedirect
 	w.httpc = httpc
+	w.clearCache()
+	w.ClearTokens()
 
 	return nil
 }
+
+// SetOAuthToken configures OAuth 2.0 authentication with the access token
+// accessToken, e.g. of an owner-only consumer, which is sent in the
+// Authorization header of all future requests. An empty accessToken turns
+// OAuth 2.0 authentication off again. Like OAuth, SetOAuthToken does not make
+// any API calls, so it is recommended to set Assert to AssertUser or
+// AssertBot to detect an invalid or expired access token. Tokens such as the
+// CSRF token are obtained with GetToken as usual. Do not mix use of
+// SetOAuthToken with Login/Logout or OAuth.
+func (w *Client) SetOAuthToken(accessToken string) {
+	w.oauthToken = accessToken
+	w.clearCache()
+	w.ClearTokens()
+}
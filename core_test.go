@@ -1,7 +1,14 @@
 package mwclient
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,8 +18,8 @@ import (
 	"cgt.name/pkg/go-mwclient/params"
 )
 
-func noSleep(d time.Duration) {
-	return // the test monster under my bed is keeping me awake
+func noSleep(ctx context.Context, d time.Duration) error {
+	return ctx.Err() // the test monster under my bed is keeping me awake
 }
 
 func setup(handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *Client) {
@@ -22,6 +29,7 @@ func setup(handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Serv
 		panic(err)
 	}
 	client.Maxlag.sleep = noSleep
+	client.sleep = noSleep
 
 	return server, client
 }
@@ -155,6 +163,30 @@ func TestMaxlagOff(t *testing.T) {
 	client.call(p, false)
 }
 
+func TestMaxlagWritesOnly(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Method == "POST" && r.Form.Get("maxlag") == "" {
+			t.Fatalf("maxlag param not set on POST. Params: %s", r.Form.Encode())
+		}
+		if r.Method == "GET" && r.Form.Get("maxlag") != "" {
+			t.Fatalf("maxlag param set on GET. Params: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Maxlag.On = true
+	client.Maxlag.WritesOnly = true
+	client.call(params.Values{}, false)
+	client.call(params.Values{}, true)
+}
+
 func TestMaxlagRetryFail(t *testing.T) {
 	httpHandler := func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
@@ -181,6 +213,85 @@ func TestMaxlagRetryFail(t *testing.T) {
 	}
 }
 
+func TestMaxlagServiceUnavailable(t *testing.T) {
+	reqCount := 0
+	var waits []time.Duration
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		if reqCount == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Maxlag.On = true
+	client.Maxlag.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	if _, err := client.Get(params.Values{}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if reqCount != 2 {
+		t.Fatalf("expected 2 requests, got %d", reqCount)
+	}
+	if len(waits) != 1 || waits[0] != defaultRetryAfter*time.Second {
+		t.Fatalf("expected one wait of %ds, got %v", defaultRetryAfter, waits)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string]int{
+		"3":                             3,
+		"Wed, 01 Jan 2020 00:00:10 GMT": 10,
+		"Tue, 31 Dec 2019 23:59:00 GMT": 0,
+		"":                              defaultRetryAfter,
+		"soon":                          defaultRetryAfter,
+	}
+	for v, want := range cases {
+		h := http.Header{}
+		h.Set("Retry-After", v)
+		if got := retryAfter(h, now); got != want {
+			t.Errorf("retryAfter(%q) != %d: got %d", v, want, got)
+		}
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		want := r.Form.Get("list")
+		if v := r.Form.Get("formatversion"); v != want {
+			t.Fatalf("formatversion != %s: formatversion=%s", want, v)
+		}
+		_, utf8 := r.Form["utf8"]
+		if utf8 != (want == "1") {
+			t.Fatalf("utf8 set incorrectly for formatversion=%s: %s", want, r.Form.Encode())
+		}
+		fmt.Fprint(w, `{"batchcomplete":""}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	// The list parameter tells the handler which formatversion to expect.
+	if _, err := client.Get(params.Values{"list": "2"}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if _, err := client.Get(params.Values{"list": "1", "formatversion": "1"}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+}
+
 func TestAssertOff(t *testing.T) {
 	httpHandler := func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
@@ -246,3 +357,959 @@ func TestAssertBot(t *testing.T) {
 	client.Assert = AssertBot
 	client.Get(p)
 }
+
+func TestAssertUsername(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("assertuser"); v != "MyBot" {
+			t.Fatalf("Expected 'assertuser=MyBot', got 'assertuser=%s'", v)
+		}
+
+		fmt.Fprint(w, `{"error":{"code":"assertnameduserfailed",
+		"info":"You are no longer logged in as \"MyBot\"."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.AssertUsername = "MyBot"
+	_, err := client.Get(params.Values{})
+	if e, ok := err.(AssertionError); !ok {
+		t.Fatalf("Expected AssertionError, got %#v", err)
+	} else if e.Code != "assertnameduserfailed" {
+		t.Fatalf("Expected code assertnameduserfailed, got %s", e.Code)
+	}
+}
+
+func TestAuthExpiredError(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"mwoauth-invalid-authorization-invalid-user",
+		"info":"The authorization headers in your request are for a user that does not exist here"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	_, err := client.Get(params.Values{})
+	if e, ok := err.(AuthExpiredError); !ok {
+		t.Fatalf("Expected AuthExpiredError, got %#v", err)
+	} else if e.Code != "mwoauth-invalid-authorization-invalid-user" {
+		t.Fatalf("Expected code mwoauth-invalid-authorization-invalid-user, got %s", e.Code)
+	}
+}
+
+func TestClientLogin(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("action") {
+		case "query":
+			if v := r.Form.Get("type"); v != LoginToken {
+				t.Fatalf("type != %s: type=%s", LoginToken, v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"logintoken":"LOGINTOKEN+\\"}}}`)
+		case "clientlogin":
+			if r.Method != "POST" {
+				t.Fatalf("clientlogin request not POSTed")
+			}
+			if v := r.PostFormValue("logintoken"); v != "LOGINTOKEN+\\" {
+				t.Fatalf("logintoken != LOGINTOKEN+\\: logintoken=%s", v)
+			}
+			if r.PostFormValue("loginreturnurl") == "" {
+				t.Fatalf("loginreturnurl not set")
+			}
+			if r.PostFormValue("password") != "password" {
+				fmt.Fprint(w, `{"clientlogin":{"status":"FAIL","messagecode":"wrongpassword",
+				"message":"Incorrect username or password entered."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"clientlogin":{"status":"PASS","username":"Username"}}`)
+		default:
+			t.Fatalf("unexpected request: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if err := client.ClientLogin("Username", "password"); err != nil {
+		t.Fatalf("ClientLogin returned error: %v", err)
+	}
+
+	err := client.ClientLogin("Username", "wrong")
+	if e, ok := err.(APIError); !ok || e.Code != "wrongpassword" {
+		t.Fatalf("expected wrongpassword APIError, got %v", err)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestSetHTTPClient(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("X-Transport"); v != "custom" {
+			t.Fatalf("X-Transport != custom: X-Transport=%s", v)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r = r.Clone(r.Context())
+			r.Header.Set("X-Transport", "custom")
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	})
+	if _, err := client.Get(params.Values{}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	cookies := client.DumpCookies()
+	if len(cookies) != 1 || cookies[0].Value != "abc" {
+		t.Fatalf("session cookie not stored in jar: %v", cookies)
+	}
+}
+
+func TestSetHTTPClientKeepsRedirectPolicy(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/w/api.php", http.StatusMovedPermanently)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.SetMaxRedirects(0)
+	c := &http.Client{}
+	client.SetHTTPClient(c)
+	if c.Jar != nil || c.CheckRedirect != nil {
+		t.Fatal("SetHTTPClient modified the HTTP client passed to it")
+	}
+
+	_, err := client.Get(params.Values{})
+	if err == nil || !strings.Contains(err.Error(), "redirects to") {
+		t.Fatalf("expected redirect error, got %v", err)
+	}
+}
+
+func TestDumpAndLoadCookies(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("action") == "login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		} else if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			t.Fatalf("session cookie not sent: %v", r.Cookies())
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if _, err := client.Post(params.Values{"action": "login"}); err != nil {
+		t.Fatalf("Post returned error: %v", err)
+	}
+	cookies := client.DumpCookies()
+
+	restarted, err := New(server.URL, "go-mwclient test")
+	if err != nil {
+		panic(err)
+	}
+	restarted.LoadCookies(cookies)
+	if _, err := restarted.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+}
+
+func TestMaxRedirectsDisabled(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.org/w/api.php", http.StatusMovedPermanently)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.SetMaxRedirects(0)
+	_, err := client.Get(params.Values{})
+	if err == nil {
+		t.Fatal("Expected error for redirected request, got nil")
+	}
+	if !strings.Contains(err.Error(), "https://example.org/w/api.php") {
+		t.Errorf("Expected error to contain redirect target, got: %v", err)
+	}
+}
+
+func TestOnDeprecation(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"warnings":{"main":{"warnings":"Unrecognized parameter: foo.\nThe parameter \"bar\" has been deprecated."},
+		"tokens":{"warnings":"action=tokens has been deprecated. Please use action=query&meta=tokens instead."}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	deprecations := map[string]string{}
+	client.OnDeprecation = func(module, message string) {
+		deprecations[module] = message
+	}
+	_, err := client.Get(params.Values{})
+	if _, ok := err.(APIWarnings); !ok {
+		t.Fatalf("Expected APIWarnings, got %#v", err)
+	}
+	if len(deprecations) != 2 {
+		t.Fatalf("Expected 2 deprecations, got %d: %v", len(deprecations), deprecations)
+	}
+	if m := deprecations["main"]; m != `The parameter "bar" has been deprecated.` {
+		t.Errorf("Unexpected deprecation message for main: %s", m)
+	}
+}
+
+func TestClose(t *testing.T) {
+	client, err := New("http://example.com/w/api.php", "go-mwclient test")
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	stopped := false
+	client.background(func(done <-chan struct{}) {
+		<-done
+		stopped = true
+	})
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if !stopped {
+		t.Fatal("Close returned before background goroutine stopped")
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("second Close returned error: %v", err)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	var sentID string
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		sentID = r.Form.Get("requestid")
+		if len(sentID) != 36 {
+			t.Fatalf("Expected a UUID, got 'requestid=%s'", sentID)
+		}
+
+		fmt.Fprintf(w, `{"error":{"code":"internal_api_error_DBQueryError","info":"Database query error."},"requestid":%q}`, sentID)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.RequestIDs = true
+	p := params.Values{}
+	_, err := client.Get(p)
+	if e, ok := err.(APIError); !ok {
+		t.Fatalf("Expected APIError, got %#v", err)
+	} else if e.RequestID != sentID {
+		t.Fatalf("e.RequestID != %s: e.RequestID=%s", sentID, e.RequestID)
+	}
+	if _, ok := p["requestid"]; ok {
+		t.Fatal("requestid was added to the params")
+	}
+}
+
+func TestPostBody(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Fatalf("Expected POST request, got %s", r.Method)
+		}
+		if v := r.Header.Get("Content-Type"); v != "application/json" {
+			t.Fatalf("Content-Type != application/json: Content-Type=%s", v)
+		}
+		if v := r.URL.Query().Get("action"); v != "test" {
+			t.Fatalf("action != test: action=%s", v)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			panic(err)
+		}
+		if string(body) != `{"foo":"bar"}` {
+			t.Fatalf("unexpected body: %s", body)
+		}
+
+		fmt.Fprint(w, `{"test":{"result":"Success"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	resp, err := client.PostBody("application/json", strings.NewReader(`{"foo":"bar"}`), params.Values{"action": "test"})
+	if err != nil {
+		t.Fatalf("PostBody returned error: %v", err)
+	}
+	if result, _ := resp.GetString("test", "result"); result != "Success" {
+		t.Fatalf("result != Success: result=%s", result)
+	}
+}
+
+func TestLastCacheStatus(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Cache", "cp3066 miss, cp3066 hit/2")
+		w.Header().Set("X-Cache-Status", "hit-front")
+		fmt.Fprint(w, `{}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if s := client.LastCacheStatus(); s != "" {
+		t.Fatalf("Expected empty cache status before first request, got %s", s)
+	}
+	client.Get(params.Values{})
+	if s := client.LastCacheStatus(); s != "hit-front" {
+		t.Fatalf("LastCacheStatus() != hit-front: LastCacheStatus()=%s", s)
+	}
+}
+
+func TestSetUserAgent(t *testing.T) {
+	client, err := New("http://example.com", "")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := client.SetUserAgent(" "); err == nil {
+		t.Fatalf("expected error for empty User-Agent")
+	}
+	if err := client.SetUserAgent("MyBot (bot@example.com)"); err != nil {
+		t.Fatalf("SetUserAgent returned error: %v", err)
+	}
+	if want := "MyBot (bot@example.com) " + DefaultUserAgent; client.UserAgent != want {
+		t.Fatalf("UserAgent != %s: UserAgent=%s", want, client.UserAgent)
+	}
+
+	var buf bytes.Buffer
+	client.Logger = log.New(&buf, "", 0)
+	if err := client.SetUserAgent(DefaultUserAgent); err != nil {
+		t.Fatalf("SetUserAgent returned error: %v", err)
+	}
+	if client.UserAgent != DefaultUserAgent || buf.Len() == 0 {
+		t.Fatalf("default User-Agent not set with warning: UserAgent=%s, log=%s", client.UserAgent, buf.String())
+	}
+}
+
+func TestSetOAuthToken(t *testing.T) {
+	var auth string
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"VALIDTOKEN"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "ANONTOKEN"
+	client.SetOAuthToken("ACCESSTOKEN")
+	token, err := client.GetToken(CSRFToken)
+	if err != nil {
+		t.Fatalf("GetToken returned error: %v", err)
+	}
+	if token != "VALIDTOKEN" {
+		t.Fatalf("token != VALIDTOKEN: token=%s", token)
+	}
+	if auth != "Bearer ACCESSTOKEN" {
+		t.Fatalf("Authorization != Bearer ACCESSTOKEN: Authorization=%s", auth)
+	}
+
+	client.SetOAuthToken("")
+	if _, err := client.Get(params.Values{}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if auth != "" {
+		t.Fatalf("Authorization sent after removing the access token: Authorization=%s", auth)
+	}
+}
+
+func TestSetDebugRedacts(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("meta") == "tokens" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"logintoken":"SECRETTOKEN+\\"}}}`)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "SECRETSESSION"})
+		fmt.Fprint(w, `{"login":{"result":"Success","lguserid":1,"lgusername":"username"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client.SetDebug(&buf)
+	if err := client.Login("username", "SECRETPASSWORD"); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+
+	dump := buf.String()
+	for _, secret := range []string{"SECRETTOKEN", "SECRETPASSWORD", "SECRETSESSION"} {
+		if strings.Contains(dump, secret) {
+			t.Fatalf("%s not redacted in debug output:\n%s", secret, dump)
+		}
+	}
+	if !strings.Contains(dump, "lgpassword=[REDACTED]") || !strings.Contains(dump, "lgname=username") {
+		t.Fatalf("unexpected debug output:\n%s", dump)
+	}
+}
+
+func TestNewInvalidURL(t *testing.T) {
+	for _, u := range []string{"api.php", "/w/api.php", "example.org/w/api.php", "http://[::1"} {
+		client, err := New(u, "go-mwclient test")
+		if err == nil {
+			t.Errorf("New(%q) returned no error", u)
+		}
+		if client != nil {
+			t.Errorf("New(%q) returned non-nil client", u)
+		}
+	}
+}
+
+func TestRequestFailure(t *testing.T) {
+	// Start and immediately close a server to get an address with nothing
+	// listening on it.
+	server := httptest.NewServer(http.NotFoundHandler())
+	apiURL := server.URL
+	server.Close()
+
+	client, err := New(apiURL, "go-mwclient test")
+	if err != nil {
+		panic(err)
+	}
+
+	resp, err := client.Get(params.Values{})
+	if err == nil {
+		t.Fatal("Expected error for unreachable API, got nil")
+	}
+	if resp != nil {
+		t.Fatalf("Expected nil response for unreachable API, got %v", resp)
+	}
+}
+
+func TestGetCtxCanceled(t *testing.T) {
+	release := make(chan struct{})
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetCtx(ctx, params.Values{})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("slow") != "" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if _, err := client.GetWithTimeout(params.Values{"slow": "1"}, 50*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded from GetWithTimeout, got %v", err)
+	}
+	if _, err := client.PostWithTimeout(params.Values{"slow": "1"}, 50*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded from PostWithTimeout, got %v", err)
+	}
+	// The timeout does not affect other requests.
+	if _, err := client.Get(params.Values{"slow": "1"}); err != nil {
+		t.Fatalf("Get after GetWithTimeout failed: %v", err)
+	}
+	if _, err := client.GetWithTimeout(params.Values{}, time.Minute); err != nil {
+		t.Fatalf("GetWithTimeout failed: %v", err)
+	}
+}
+
+func TestGetCtxCanceledWhileWaiting(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		if r.URL.Query().Get("maxlag") != "" {
+			w.Header().Set("X-Database-Lag", "3600")
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+	client.Maxlag.sleep = sleepContext
+	client.sleep = sleepContext
+	client.SetBackoff(ExponentialBackoff{Base: time.Hour})
+
+	for _, maxlag := range []bool{true, false} {
+		client.Maxlag.On = maxlag
+		client.Retries = 2
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		_, err := client.GetCtx(ctx, params.Values{})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Expected context.DeadlineExceeded (maxlag: %t), got %v", maxlag, err)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Fatalf("GetCtx returned %s after the deadline (maxlag: %t)", d, maxlag)
+		}
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	for _, compress := range []bool{true, false} {
+		server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				t.Errorf("Accept-Encoding != gzip: Accept-Encoding=%s", r.Header.Get("Accept-Encoding"))
+			}
+			body := `{"batchcomplete":true,"query":{"general":{"sitename":"Test"}}}`
+			if !compress {
+				fmt.Fprint(w, body)
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			fmt.Fprint(zw, body)
+			zw.Close()
+		})
+
+		resp, err := client.Get(params.Values{"action": "query", "meta": "siteinfo"})
+		server.Close()
+		if err != nil {
+			t.Fatalf("Get returned error (compressed: %t): %v", compress, err)
+		}
+		if sitename, _ := resp.GetString("query", "general", "sitename"); sitename != "Test" {
+			t.Fatalf("sitename != Test (compressed: %t): sitename=%s", compress, sitename)
+		}
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "<html><body>Too many requests</body></html>")
+	})
+	defer server.Close()
+
+	_, err := client.Get(params.Values{"action": "query"})
+	httperr, ok := err.(HTTPError)
+	if !ok {
+		t.Fatalf("expected HTTPError, got %T: %v", err, err)
+	}
+	if httperr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("StatusCode != 429: StatusCode=%d", httperr.StatusCode)
+	}
+	if httperr.RetryAfter != 30 {
+		t.Fatalf("RetryAfter != 30: RetryAfter=%d", httperr.RetryAfter)
+	}
+	if httperr.Body != "<html><body>Too many requests</body></html>" {
+		t.Fatalf("unexpected Body: %s", httperr.Body)
+	}
+	if !isTransient(err) {
+		t.Fatalf("HTTP 429 error is not transient")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var requests int
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	})
+	defer server.Close()
+
+	client.Retries = 2
+	if _, err := client.Get(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("requests != 3: requests=%d", requests)
+	}
+
+	requests = 0
+	if _, err := client.Post(params.Values{"action": "purge"}); err == nil {
+		t.Fatalf("expected error for failed POST request")
+	}
+	if requests != 1 {
+		t.Fatalf("POST request was retried: requests=%d", requests)
+	}
+
+	requests = 0
+	if _, err := client.PostIdempotent(params.Values{"action": "query"}); err != nil {
+		t.Fatalf("PostIdempotent returned error: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("requests != 3: requests=%d", requests)
+	}
+}
+
+func TestRetriesAPIError(t *testing.T) {
+	var requests int
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"error":{"code":"badvalue","info":"Unrecognized value"}}`)
+	})
+	defer server.Close()
+
+	client.Retries = 2
+	if _, err := client.Get(params.Values{"action": "query"}); err == nil {
+		t.Fatalf("expected API error")
+	}
+	if requests != 1 {
+		t.Fatalf("request failing with an API error was retried: requests=%d", requests)
+	}
+}
+
+func TestPlainMapParams(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.Form.Get("action") != "query" || r.Form.Get("titles") != "A|B" {
+			t.Fatalf("unexpected parameters: %v", r.Form)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	})
+	defer server.Close()
+
+	p := map[string]string{"action": "query", "titles": "A|B"}
+	if _, err := client.Get(p); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if _, err := client.Post(p); err != nil {
+		t.Fatalf("Post returned error: %v", err)
+	}
+}
+
+func TestGetInto(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("meta") {
+		case "siteinfo":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"general":{"sitename":"Test","maxarticlesize":2048}}}`)
+		case "userinfo":
+			fmt.Fprint(w, `{"warnings":{"main":{"warnings":"Unrecognized parameter: foo."}},
+			"batchcomplete":true,"query":{"general":{"sitename":"Warned"}}}`)
+		default:
+			fmt.Fprint(w, `{"error":{"code":"badvalue","info":"Unrecognized value for parameter \"meta\"."}}`)
+		}
+	})
+	defer server.Close()
+
+	var r struct {
+		Query struct {
+			General struct {
+				SiteName       string `json:"sitename"`
+				MaxArticleSize int    `json:"maxarticlesize"`
+			} `json:"general"`
+		} `json:"query"`
+	}
+	if err := client.GetInto(params.Values{"action": "query", "meta": "siteinfo"}, &r); err != nil {
+		t.Fatalf("GetInto returned error: %v", err)
+	}
+	if r.Query.General.SiteName != "Test" || r.Query.General.MaxArticleSize != 2048 {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	err := client.GetInto(params.Values{"action": "query", "meta": "nonexistent"}, &r)
+	if apierr, ok := err.(APIError); !ok || apierr.Code != "badvalue" {
+		t.Fatalf("expected badvalue APIError, got %#v", err)
+	}
+	if r.Query.General.SiteName != "Test" {
+		t.Fatalf("error response decoded into v: %+v", r)
+	}
+
+	err = client.GetInto(params.Values{"action": "query", "meta": "userinfo"}, &r)
+	if _, ok := err.(APIWarnings); !ok {
+		t.Fatalf("expected APIWarnings, got %#v", err)
+	}
+	if r.Query.General.SiteName != "Warned" {
+		t.Fatalf("response with warnings not decoded: %+v", r)
+	}
+}
+
+func TestGetRawPostRaw(t *testing.T) {
+	body := `{"batchcomplete":true,"query":{"general":{"sitename":"Test"}}}`
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.Form.Get("format") != "json" || r.Form.Get("formatversion") != "2" {
+			t.Fatalf("format parameters not set: %v", r.Form)
+		}
+		if !strings.HasPrefix(r.Header.Get("User-Agent"), "go-mwclient test") {
+			t.Fatalf("User-Agent not set: %s", r.Header.Get("User-Agent"))
+		}
+		fmt.Fprint(w, body)
+	})
+	defer server.Close()
+
+	p := params.Values{"action": "query", "meta": "siteinfo"}
+	for name, f := range map[string]func(params.Values) ([]byte, error){
+		"GetRaw":  client.GetRaw,
+		"PostRaw": client.PostRaw,
+	} {
+		raw, err := f(p)
+		if err != nil {
+			t.Fatalf("%s returned error: %v", name, err)
+		}
+		if string(raw) != body {
+			t.Fatalf("%s did not return the raw body: %s", name, raw)
+		}
+
+		var r struct {
+			Query struct {
+				General struct {
+					SiteName string `json:"sitename"`
+				} `json:"general"`
+			} `json:"query"`
+		}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			t.Fatalf("unable to decode response of %s: %v", name, err)
+		}
+		if r.Query.General.SiteName != "Test" {
+			t.Fatalf("sitename != Test: sitename=%s", r.Query.General.SiteName)
+		}
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	loggedIn := false
+	logins := 0
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch {
+		case r.Form.Get("meta") == "tokens":
+			if r.Form.Get("assert") != "" {
+				t.Fatalf("login token request sent with assert=%s", r.Form.Get("assert"))
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"logintoken":"LOGINTOKEN"}}}`)
+		case r.PostForm.Get("action") == "login":
+			if r.PostForm.Get("assert") != "" {
+				t.Fatalf("login request sent with assert=%s", r.PostForm.Get("assert"))
+			}
+			logins++
+			loggedIn = true
+			fmt.Fprint(w, `{"login":{"result":"Success","lguserid":1,"lgusername":"Bot"}}`)
+		case r.Form.Get("meta") == "userinfo":
+			if loggedIn {
+				fmt.Fprint(w, `{"batchcomplete":true,"query":{"userinfo":{"id":1,"name":"Bot"}}}`)
+			} else if r.Form.Get("assert") == "user" {
+				fmt.Fprint(w, `{"error":{"code":"assertuserfailed","info":"You are no longer logged in."}}`)
+			} else {
+				fmt.Fprint(w, `{"batchcomplete":true,"query":{"userinfo":{"id":0,"name":"127.0.0.1","anon":true}}}`)
+			}
+		default:
+			t.Fatalf("unexpected request: %v", r.Form)
+		}
+	})
+	defer server.Close()
+
+	// An anonymous client is ready as it is.
+	if err := client.WarmUp(); err != nil {
+		t.Fatalf("WarmUp returned error for anonymous client: %v", err)
+	}
+
+	client.RememberLogin = true
+	if err := client.Login("Bot", "password"); err != nil {
+		t.Fatalf("Login returned error: %v", err)
+	}
+	client.Assert = AssertUser
+	client.Tokens[CSRFToken] = "OLDTOKEN"
+	client.SetCache(10, time.Minute)
+	client.cache.add("key", []byte(`{}`), "")
+
+	// The session expires.
+	loggedIn = false
+	if err := client.WarmUp(); err != nil {
+		t.Fatalf("WarmUp returned error: %v", err)
+	}
+	if logins != 2 {
+		t.Fatalf("logins != 2: logins=%d", logins)
+	}
+	if client.Assert != AssertUser {
+		t.Fatalf("Assert not restored: Assert=%d", client.Assert)
+	}
+	if _, ok := client.Tokens[CSRFToken]; ok {
+		t.Fatalf("token of the expired session was kept")
+	}
+	if _, ok := client.cache.get("key"); ok {
+		t.Fatalf("response cached in the expired session was kept")
+	}
+}
+
+func TestWarmUpNotRemembered(t *testing.T) {
+	server, client := setup(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"assertuserfailed","info":"You are no longer logged in."}}`)
+	})
+	defer server.Close()
+
+	client.Assert = AssertUser
+	if _, ok := client.WarmUp().(AssertionError); !ok {
+		t.Fatalf("expected AssertionError")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	requests := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		requests++
+		if v := r.Form.Get("action"); v != "query" {
+			t.Fatalf("write request sent in read-only mode: action=%s", v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"VALIDTOKEN"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.ReadOnly = true
+	if _, err := client.Get(params.Values{"action": "query", "meta": "tokens"}); err != nil {
+		t.Fatalf("query failed in read-only mode: %v", err)
+	}
+	if err := client.Edit(params.Values{"title": "PAGE", "text": "text"}); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly from Edit, got %v", err)
+	}
+	if _, err := client.Post(params.Values{"action": "delete", "title": "PAGE"}); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly from Post, got %v", err)
+	}
+	if _, err := client.Upload("Example.txt", strings.NewReader("file content"), nil); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly from Upload, got %v", err)
+	}
+	if _, err := client.PostBody("text/plain", strings.NewReader("action=edit"), nil); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly from PostBody, got %v", err)
+	}
+	// Only the query and the token request for the edit were sent.
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestReadOnlyWriteHelpers(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Method == "POST" {
+			t.Errorf("POST request sent in read-only mode: %s", r.Form.Encode())
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"VALIDTOKEN",
+		"watchtoken":"VALIDTOKEN","setglobalaccountstatustoken":"VALIDTOKEN"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.ReadOnly = true
+	helpers := map[string]func() error{
+		"Edit": func() error { return client.Edit(params.Values{"title": "PAGE", "text": "text"}) },
+		"EditWithResult": func() error {
+			_, err := client.EditWithResult(params.Values{"title": "PAGE", "text": "text"})
+			return err
+		},
+		"Undo":          func() error { return client.Undo("PAGE", 2, 1, "") },
+		"WrapText":      func() error { return client.WrapText("PAGE", "a", "b", "", nil) },
+		"EditSection":   func() error { return client.EditSection("PAGE", 1, "text", "") },
+		"AppendText":    func() error { return client.AppendText("PAGE", "text", "") },
+		"PrependText":   func() error { return client.PrependText("PAGE", "text", "") },
+		"Move":          func() error { return client.Move("PAGE", "PAGE2", "", nil) },
+		"Delete":        func() error { return client.Delete("PAGE", "") },
+		"Protect":       func() error { return client.Protect("PAGE", "edit=sysop", "") },
+		"ResetPassword": func() error { return client.ResetPassword("User") },
+		"AddTags": func() error {
+			_, err := client.AddTags([]int{1}, nil, []string{"tag"}, nil, "")
+			return err
+		},
+		"RotateImage": func() error {
+			_, err := client.RotateImage("File:Example.jpg", 90)
+			return err
+		},
+		"Upload": func() error {
+			_, err := client.Upload("Example.txt", strings.NewReader("text"), nil)
+			return err
+		},
+		"UploadChunked": func() error {
+			_, err := client.UploadChunked("Example.txt", strings.NewReader("text"), 4, 2, nil, nil)
+			return err
+		},
+		"Watch":                    func() error { return client.Watch([]string{"PAGE"}, "") },
+		"Unwatch":                  func() error { return client.Unwatch([]string{"PAGE"}) },
+		"MarkNotificationsRead":    func() error { return client.MarkNotificationsRead([]int{1}) },
+		"MarkAllNotificationsRead": func() error { return client.MarkAllNotificationsRead() },
+		"LockGlobalAccount":        func() error { return client.LockGlobalAccount("User", "") },
+		"UnlockGlobalAccount":      func() error { return client.UnlockGlobalAccount("User", "") },
+		"Purge": func() error {
+			_, err := client.Purge("PAGE")
+			return err
+		},
+		"token": func() error {
+			_, err := client.Post(params.Values{"action": "unknownwrite", "token": "VALIDTOKEN"})
+			return err
+		},
+	}
+	for name, f := range helpers {
+		if err := f(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("expected ErrReadOnly from %s, got %v", name, err)
+		}
+	}
+}
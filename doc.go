@@ -5,7 +5,14 @@ go-mwclient is intended for users who are already familiar with (or are
 willing to learn) the MediaWiki API. It is intended to make dealing with
 the API more convenient, but not to hide it.
 
-go-mwclient v1 uses version 2 of the MW JSON API.
+go-mwclient v1 uses version 2 of the MW JSON API (formatversion=2), which
+is sent with every request unless the formatversion parameter is set.
+In version 2, booleans are JSON booleans instead of keys that are present
+with an empty string value, the pages of a query are returned as an array
+instead of an object keyed by page ID, and the content of revisions is in
+"content" instead of "*". To get a response in version 1 of the format
+(e.g., for code written for it), set formatversion to "1" in the parameters
+of the request. The helper methods of go-mwclient always use version 2.
 
 Basic usage
 
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/antonholmquist/jason"
 
@@ -19,6 +22,20 @@ var ErrEditNoChange = errors.New("edit successful, but did not change page")
 // See GetPage[s]ByName().
 var ErrPageNotFound = errors.New("wiki page not found")
 
+// ErrSlotNotFound is returned by GetPageSlots when the latest revision of
+// a page does not have a requested content slot.
+var ErrSlotNotFound = errors.New("revision content slot not found")
+
+// ErrEditConflict is returned by Client.Edit() and the methods that edit
+// through it (e.g., Client.EditSection) when the page was changed after the
+// time given by the basetimestamp or starttimestamp parameter. The caller
+// should get the page again, reapply its change, and retry the edit.
+var ErrEditConflict = errors.New("edit conflict")
+
+// ErrNoSuchSection is returned by GetSectionContent and EditSection when the
+// page does not have the requested section.
+var ErrNoSuchSection = errors.New("page section not found")
+
 // Edit takes a params.Values containing parameters for an edit action and
 // attempts to perform the edit. Edit will return nil if no errors are detected.
 // If the edit was successful, but did not result in a change to the page
@@ -28,6 +45,13 @@ var ErrPageNotFound = errors.New("wiki page not found")
 //	https://www.mediawiki.org/wiki/API:Edit#Parameters
 // Edit will set the 'action' and 'token' parameters automatically, but if the
 // token field in p is non-empty, Edit will not override it.
+// If p contains the 'basetimestamp' parameter (the timestamp of the revision
+// the edit is based on) and the page has been edited since, ErrEditConflict
+// is returned.
+// When editing pages that are not wikitext, e.g. JSON or Lua modules,
+// the 'contentmodel' and 'contentformat' parameters can be set in p. If they
+// are not, the content model of the existing page (or the default content
+// model of the title, for new pages) and its default format are used.
 // Edit does not check p for sanity.
 // p example:
 //	params.Values{
@@ -37,50 +61,277 @@ var ErrPageNotFound = errors.New("wiki page not found")
 //		"notminor": "",
 //	}
 func (w *Client) Edit(p params.Values) error {
-	// If edit token not set, obtain one from API or cache
-	if p["token"] == "" {
-		csrfToken, err := w.GetToken(CSRFToken)
-		if err != nil {
-			return fmt.Errorf("unable to obtain csrf token: %s", err)
-		}
-		p["token"] = csrfToken
+	result, err := w.EditWithResult(p)
+	if err != nil {
+		return err
+	}
+	if result.NoChange {
+		return ErrEditNoChange
+	}
+	return nil
+}
+
+// EditResult is the outcome of an edit, as returned by Client.EditWithResult.
+type EditResult struct {
+	// Result is "Success" if the edit was successful.
+	Result string `json:"result"`
+	PageID int    `json:"pageid"`
+	Title  string `json:"title"`
+	// OldRevID and NewRevID are the IDs of the revisions before and after
+	// the edit. They are zero if the edit did not change the page.
+	OldRevID     int    `json:"oldrevid"`
+	NewRevID     int    `json:"newrevid"`
+	NewTimestamp string `json:"newtimestamp"`
+	// NoChange is true if the edit did not change the page.
+	NoChange bool `json:"nochange"`
+	// New is true if the edit created the page.
+	New bool `json:"new"`
+	// ContentModel is the content model of the page after the edit,
+	// e.g. "wikitext" or "json".
+	ContentModel string `json:"contentmodel"`
+}
+
+// EditWithResult is like Edit, but returns the result of the edit.
+// Unlike Edit, EditWithResult does not return ErrEditNoChange if the edit
+// did not change the page; the NoChange field of the result is set instead.
+// If the edit requires solving a CAPTCHA, a CaptchaError is returned, unless
+// Client.CaptchaSolver is set, in which case it is called and the edit is
+// sent once more with its answer.
+func (w *Client) EditWithResult(p params.Values) (EditResult, error) {
+	result, err := w.edit(p)
+	captcha, ok := err.(CaptchaError)
+	if !ok || w.CaptchaSolver == nil {
+		return result, err
+	}
+
+	answer, err := w.CaptchaSolver(captcha)
+	if err != nil {
+		return result, err
 	}
+	captcha.Answer(p, answer)
+	return w.edit(p)
+}
 
+// edit sends the edit request p and decodes its result.
+func (w *Client) edit(p params.Values) (EditResult, error) {
 	p["action"] = "edit"
 
-	resp, err := w.Post(p)
+	resp, err := w.postWithToken(CSRFToken, p)
+	if apierr, ok := err.(APIError); ok && apierr.Code == "editconflict" {
+		return EditResult{}, ErrEditConflict
+	}
 	if err != nil {
-		return err
+		return EditResult{}, err
 	}
 
-	editResult, err := resp.GetString("edit", "result")
+	edit, err := resp.GetObject("edit")
 	if err != nil {
-		return fmt.Errorf("unable to assert 'result' field to type string\n")
+		return EditResult{}, fmt.Errorf("unable to assert 'edit' field to type object\n")
+	}
+	// The nochange and new flags are booleans in formatversion=2, but empty
+	// strings that are only present if set in formatversion=1.
+	var r struct {
+		EditResult
+		NoChange json.RawMessage `json:"nochange"`
+		New      json.RawMessage `json:"new"`
+	}
+	if err := unmarshalObject(edit, &r); err != nil {
+		return EditResult{}, fmt.Errorf("unable to decode edit result: %v", err)
 	}
+	result := r.EditResult
+	result.NoChange = isFlagSet(r.NoChange)
+	result.New = isFlagSet(r.New)
 
-	if editResult != "Success" {
-		if captcha, err := resp.GetObject("edit", "captcha"); err == nil {
-			captchaBytes, err := captcha.Marshal()
-			if err != nil {
-				return fmt.Errorf("error occured while creating error message: %s", err)
-			}
-			var captchaerr CaptchaError
-			err = json.Unmarshal(captchaBytes, &captchaerr)
-			if err != nil {
-				return fmt.Errorf("error occured while creating error message: %s", err)
-			}
-			return captchaerr
+	if result.Result != "Success" {
+		if captcha, err := edit.GetObject("captcha"); err == nil {
+			return result, newCaptchaError(captcha)
 		}
 
-		edit, _ := resp.GetValue("edit")
-		return fmt.Errorf("unrecognized response: %v", edit)
+		return result, fmt.Errorf("unrecognized response: %v", edit)
 	}
 
-	if nochange, err := resp.GetBoolean("edit", "nochange"); err == nil && nochange {
-		return ErrEditNoChange
+	return result, nil
+}
+
+// isFlagSet reports whether the flag value v, which is a boolean in
+// formatversion=2 and an empty string in formatversion=1, is set.
+func isFlagSet(v json.RawMessage) bool {
+	return len(v) > 0 && string(v) != "false" && string(v) != "null"
+}
+
+// ErrUndoFailure is returned by Client.Undo() when the edit could not be
+// undone automatically because of conflicting intermediate edits.
+var ErrUndoFailure = errors.New("undo failed due to conflicting intermediate edits")
+
+// Undo reverts the revision revid of the page title by editing the page.
+// If undoafter is non-zero, all revisions from (but not including) undoafter
+// up to and including revid are undone. summary is used as edit summary;
+// if it is empty, MediaWiki's default undo summary is used.
+// If the edit cannot be undone cleanly, ErrUndoFailure is returned and
+// the revision(s) must be reverted manually. Otherwise, Undo returns what
+// Edit returns.
+func (w *Client) Undo(title string, revid, undoafter int, summary string) error {
+	p := params.Values{
+		"title": title,
+		"undo":  strconv.Itoa(revid),
+	}
+	if undoafter != 0 {
+		p["undoafter"] = strconv.Itoa(undoafter)
+	}
+	if summary != "" {
+		p["summary"] = summary
 	}
 
-	return nil
+	err := w.Edit(p)
+	if apierr, ok := err.(APIError); ok && apierr.Code == "undofailure" {
+		return ErrUndoFailure
+	}
+	return err
+}
+
+// WrapText adds prependText to the beginning and appendText to the end of
+// the page title in a single edit, so that only one revision is created.
+// Either may be empty. summary is used as edit summary. p may contain
+// additional action=edit parameters, e.g. "section" to wrap the text of
+// a section instead of the whole page, or "minor". p is not modified.
+// WrapText returns what Edit returns.
+func (w *Client) WrapText(title, prependText, appendText, summary string, p params.Values) error {
+	q := params.Values{
+		"title":       title,
+		"prependtext": prependText,
+		"appendtext":  appendText,
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	if summary != "" {
+		q["summary"] = summary
+	}
+	return w.Edit(q)
+}
+
+// EditSection replaces the text of the section numbered section of the page
+// title with text, which should include the heading of the section. Section
+// 0 is the lead section, before the first heading. summary is used as edit
+// summary. If the page has no such section, ErrNoSuchSection is returned.
+// Otherwise, EditSection returns what Edit returns. EditSection cannot detect
+// edit conflicts; to do so, use Edit with 'section' and 'basetimestamp'.
+//
+// To add a new section, use Edit with 'section' set to "new" instead. In that
+// case, 'title' is still the page the section is added to, and the
+// 'sectiontitle' parameter is the heading of the new section, which is also
+// used as edit summary if 'summary' is not set.
+func (w *Client) EditSection(title string, section int, text, summary string) error {
+	p := params.Values{
+		"title":   title,
+		"section": strconv.Itoa(section),
+		"text":    text,
+	}
+	if summary != "" {
+		p["summary"] = summary
+	}
+
+	err := w.Edit(p)
+	if apierr, ok := err.(APIError); ok && apierr.Code == "nosuchsection" {
+		return ErrNoSuchSection
+	}
+	return err
+}
+
+// AppendText adds text to the end of the page title (appendtext), without
+// sending the rest of the page's text. The page is created if it does not
+// exist. summary is used as edit summary. AppendText returns what Edit
+// returns.
+func (w *Client) AppendText(title, text, summary string) error {
+	p := params.Values{
+		"title":      title,
+		"appendtext": text,
+	}
+	if summary != "" {
+		p["summary"] = summary
+	}
+	return w.Edit(p)
+}
+
+// PrependText adds text to the beginning of the page title (prependtext),
+// without sending the rest of the page's text. The page is created if it does
+// not exist. summary is used as edit summary. PrependText returns what Edit
+// returns.
+func (w *Client) PrependText(title, text, summary string) error {
+	p := params.Values{
+		"title":       title,
+		"prependtext": text,
+	}
+	if summary != "" {
+		p["summary"] = summary
+	}
+	return w.Edit(p)
+}
+
+// postWithToken POSTs p after setting its 'token' parameter to a token of
+// type tokenName obtained through GetToken. If the token field in p is
+// non-empty, it will not be overridden. Otherwise, if the API rejects the
+// token as invalid, a new token is obtained and the request is retried once.
+// If w.DryRun is true, the request is not sent, and postWithToken returns
+// a response in which the result of the action is "Success".
+func (w *Client) postWithToken(tokenName string, p params.Values) (*jason.Object, error) {
+	if w.DryRun {
+		w.logf("mwclient: dry run: not sending POST request: %s", p.Encode())
+		return jason.NewObjectFromBytes([]byte(fmt.Sprintf(`{%q:{"result":"Success"}}`, p.Get("action"))))
+	}
+
+	if p["token"] != "" {
+		return w.Post(p)
+	}
+
+	token, err := w.GetToken(tokenName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain %s token: %s", tokenName, err)
+	}
+	p["token"] = token
+	resp, err := w.Post(p)
+	if apierr, ok := err.(APIError); !ok || apierr.Code != "badtoken" {
+		return resp, err
+	}
+
+	// The cached token has expired, e.g. because the session was renewed.
+	// Obtain a new one and try once more.
+	w.logf("mwclient: %s token rejected; retrying with a new token", tokenName)
+	w.invalidateToken(tokenName, err, token)
+	token, err = w.GetToken(tokenName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain %s token: %s", tokenName, err)
+	}
+	p["token"] = token
+	return w.Post(p)
+}
+
+// invalidateToken removes token from the token cache if err is a badtoken
+// API error and token is still the cached token of type tokenName, so that the
+// next call to GetToken obtains a new one.
+func (w *Client) invalidateToken(tokenName string, err error, token string) {
+	if apierr, ok := err.(APIError); !ok || apierr.Code != "badtoken" {
+		return
+	}
+	w.tokensMu.Lock()
+	if w.Tokens[tokenName] == token {
+		delete(w.Tokens, tokenName)
+	}
+	w.tokensMu.Unlock()
+}
+
+// ClearTokens removes all tokens from the token cache, so that they are
+// obtained from the API again when they are next needed. Tokens are tied to
+// the session, so ClearTokens is called when the session changes through
+// Login, ClientLogin, Logout, or OAuth; it only has to be called directly if
+// the session is changed by other means, e.g. by modifying the cookie jar of
+// the HTTP client.
+func (w *Client) ClearTokens() {
+	w.tokensMu.Lock()
+	for name := range w.Tokens {
+		delete(w.Tokens, name)
+	}
+	w.tokensMu.Unlock()
 }
 
 // BriefRevision contains basic information on a single revision of a page.
@@ -138,7 +389,12 @@ func (w *Client) getPages(areNames bool, pageIDsOrNames ...string) (pages map[st
 	if err != nil {
 		return nil, err
 	}
-	return handleGetPages(pageIDsOrNames, resp)
+	pages, err = handleGetPages(pageIDsOrNames, resp)
+	for name, page := range pages {
+		page.Content = w.normalizeContent(page.Content)
+		pages[name] = page
+	}
+	return pages, err
 }
 
 func handleGetPages(pageNames []string, resp getPagesResponse) (pages map[string]BriefRevision, err error) {
@@ -229,7 +485,9 @@ type getPagesResponse struct {
 }
 
 // GetPageByName gets the content of a page (specified by its name) and
-// the timestamp of its most recent revision.
+// the timestamp of its most recent revision, which can be passed to Edit
+// as the 'basetimestamp' parameter to detect edit conflicts.
+// If the page does not exist, ErrPageNotFound is returned.
 func (w *Client) GetPageByName(pageName string) (content string, timestamp string, err error) {
 	return w.getPage(pageName, true)
 }
@@ -246,12 +504,152 @@ func (w *Client) GetPageByID(pageID string) (content string, timestamp string, e
 	return w.getPage(pageID, false)
 }
 
+// GetRawWikitext gets the content of the page pageName from the index.php
+// entry point (action=raw) instead of the API. This is useful on wikis where
+// reading page content through the API is restricted or rate limited.
+// index.php is assumed to be in the same directory as the API URL
+// (e.g., https://en.wikipedia.org/w/index.php).
+// If the page does not exist, ErrPageNotFound is returned. Other error
+// responses are returned as an HTTPError, and the request is retried as
+// specified by Client.Retries.
+func (w *Client) GetRawWikitext(pageName string) (string, error) {
+	p := params.Values{"title": pageName, "action": "raw"}
+	body, err := w.callWithOptions(p, callOptions{indexPHP: true})
+	if httperr, ok := err.(HTTPError); ok && httperr.StatusCode == http.StatusNotFound {
+		return "", ErrPageNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("error reading HTTP response: %v", err)
+	}
+	return w.normalizeContent(string(content)), nil
+}
+
 // GetPagesByID gets the content of pages (specified by id).
 // Returns a map of input page names to BriefRevisions.
 func (w *Client) GetPagesByID(pageIDs ...string) (pages map[string]BriefRevision, err error) {
 	return w.getPages(false, pageIDs...)
 }
 
+// GetPageSlots gets the content of the named slots (e.g., "main" or
+// "mediainfo") of the latest revision of the page pageName. If no slots are
+// given, the content of all slots is returned. The content is returned as a
+// map of slot names to content.
+// If the page does not exist, ErrPageNotFound is returned. If one of the
+// named slots does not exist on the revision, ErrSlotNotFound is returned.
+// As with Get, API warnings are returned as the error value, but,
+// as with GetPagesByName, the slots are returned along with the warnings.
+func (w *Client) GetPageSlots(pageName string, slots ...string) (map[string]string, error) {
+	p := params.Values{
+		"action": "query",
+		"prop":   "revisions",
+		"titles": pageName,
+		"rvprop": "content",
+	}
+	if len(slots) == 0 {
+		p.Set("rvslots", "*")
+	} else {
+		p.AddRange("rvslots", slots...)
+	}
+
+	resp, err := w.Get(p)
+	if resp == nil {
+		return nil, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return nil, err
+	}
+	warnings := err
+
+	var r struct {
+		Query struct {
+			Pages []struct {
+				Missing   bool `json:"missing"`
+				Revisions []struct {
+					Slots map[string]struct {
+						Content string `json:"content"`
+					} `json:"slots"`
+				} `json:"revisions"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Query.Pages) == 0 {
+		return nil, fmt.Errorf("invalid API response: no pages: %v", resp)
+	}
+	page := r.Query.Pages[0]
+	if page.Missing {
+		return nil, ErrPageNotFound
+	}
+	if len(page.Revisions) == 0 {
+		return nil, fmt.Errorf("invalid API response: no revisions: %v", resp)
+	}
+
+	contents := make(map[string]string, len(page.Revisions[0].Slots))
+	for slot, content := range page.Revisions[0].Slots {
+		contents[slot] = w.normalizeContent(content.Content)
+	}
+	for _, slot := range slots {
+		if _, ok := contents[slot]; !ok {
+			return nil, ErrSlotNotFound
+		}
+	}
+
+	return contents, warnings
+}
+
+// GetSectionContent gets the content of the section section of the latest
+// revision of the page pageName (rvsection). Section 0 is the lead section,
+// and the following sections are numbered in the order they appear on the page.
+// If the page does not exist, ErrPageNotFound is returned. If it does not have
+// the section, ErrNoSuchSection is returned.
+func (w *Client) GetSectionContent(pageName string, section int) (string, error) {
+	p := params.Values{
+		"action":    "query",
+		"prop":      "revisions",
+		"titles":    pageName,
+		"rvprop":    "content",
+		"rvslots":   "main",
+		"rvsection": strconv.Itoa(section),
+	}
+
+	resp, err := w.Get(p)
+	if apierr, ok := err.(APIError); ok && (apierr.Code == "nosuchsection" || apierr.Code == "rvnosuchsection") {
+		return "", ErrNoSuchSection
+	}
+	if resp == nil {
+		return "", err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return "", err
+	}
+	warnings := err
+
+	var r getPagesResponse
+	if err := unmarshalObject(resp, &r); err != nil {
+		return "", err
+	}
+	if len(r.Query.Pages) == 0 {
+		return "", fmt.Errorf("invalid API response: no pages: %v", resp)
+	}
+	page := r.Query.Pages[0]
+	if page.Missing {
+		return "", ErrPageNotFound
+	}
+	if len(page.Revisions) == 0 {
+		return "", fmt.Errorf("invalid API response: no revisions: %v", resp)
+	}
+
+	return w.normalizeContent(page.Revisions[0].Slots.Main.Content), warnings
+}
+
 // These consts represents MW API token names.
 // They are meant to be used with the GetToken method like so:
 // 	ClientInstance.GetToken(mwclient.CSRFToken)
@@ -266,20 +664,53 @@ const (
 	LoginToken                  = "login"
 )
 
+// legacyTokenNames maps the token names used by the removed action=tokens
+// module and prop=info&intoken to the token types that replaced them.
+var legacyTokenNames = map[string]string{
+	"edit":    CSRFToken,
+	"delete":  CSRFToken,
+	"protect": CSRFToken,
+	"move":    CSRFToken,
+	"block":   CSRFToken,
+	"unblock": CSRFToken,
+	"email":   CSRFToken,
+	"import":  CSRFToken,
+	"options": CSRFToken,
+}
+
 // GetToken returns a specified token (and an error if this is not possible).
 // If the token is not already available in the Client.Tokens map,
 // it will attempt to retrieve it via the API.
-// tokenName should be "edit" (or whatever), not "edittoken".
+// tokenName should be "csrf" (or whatever), not "csrftoken".
 // The token consts (e.g., mwclient.CSRFToken) should be used
-// as the tokenName argument.
+// as the tokenName argument, but the names of legacy token types that have
+// been merged into the CSRF token (e.g., "edit" or "delete") are accepted too.
+// If several goroutines request the same token at the same time, only one
+// API request is made and its result is shared.
 func (w *Client) GetToken(tokenName string) (string, error) {
+	if name, ok := legacyTokenNames[tokenName]; ok {
+		tokenName = name
+	}
+
 	// Always obtain a fresh login token
-	if tokenName != LoginToken {
-		if tok, ok := w.Tokens[tokenName]; ok {
+	if tokenName == LoginToken {
+		return w.fetchToken(tokenName, callOptions{})
+	}
+
+	return w.tokenFlight.do(tokenName, func() (string, error) {
+		w.tokensMu.RLock()
+		tok, ok := w.Tokens[tokenName]
+		w.tokensMu.RUnlock()
+		if ok {
 			return tok, nil
 		}
-	}
+		return w.fetchToken(tokenName, callOptions{})
+	})
+}
 
+// fetchToken obtains a token of type tokenName from the API with the request
+// options opts and, unless it is a login token, stores it in w.Tokens.
+func (w *Client) fetchToken(tokenName string, opts callOptions) (string, error) {
 	p := params.Values{
 		"action":   "query",
 		"meta":     "tokens",
@@ -287,18 +718,145 @@ func (w *Client) GetToken(tokenName string) (string, error) {
 		"continue": "",
 	}
 
-	resp, err := w.Get(p)
+	// Tokens are tied to the session and must never be served from the cache.
+	opts.fresh = true
+	resp, err := w.callJSONWithOptions(p, opts)
+	var token string
+	if _, ok := checkModule(err, "meta", "tokens").(UnknownModuleError); ok && tokenName != LoginToken {
+		token, err = w.fetchLegacyToken(tokenName)
+		if err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	} else {
+		token, err = resp.GetString("query", "tokens", tokenName+"token")
+		if err != nil {
+			// This really shouldn't happen.
+			return "", fmt.Errorf("error occured while converting token to string: %s", err)
+		}
+	}
+	if tokenName != LoginToken {
+		w.tokensMu.Lock()
+		w.Tokens[tokenName] = token
+		w.tokensMu.Unlock()
+	}
+	return token, nil
+}
+
+// fetchLegacyToken obtains a token of type tokenName from a wiki that does not
+// support meta=tokens (MediaWiki 1.23 and older), using action=tokens or,
+// if that is not supported either (MediaWiki 1.19 and older),
+// prop=info&intoken.
+func (w *Client) fetchLegacyToken(tokenName string) (string, error) {
+	// The CSRF token was called the edit token.
+	legacyName := tokenName
+	if tokenName == CSRFToken {
+		legacyName = "edit"
+	}
+
+	resp, err := w.GetFresh(params.Values{"action": "tokens", "type": legacyName})
+	if err == nil {
+		token, err := resp.GetString("tokens", legacyName+"token")
+		if err != nil {
+			return "", fmt.Errorf("invalid API response: no %s token: %v", legacyName, resp)
+		}
+		return token, nil
+	}
+	if _, ok := checkModule(err, "action", "tokens").(UnknownModuleError); !ok {
+		return "", err
+	}
+
+	resp, err = w.GetFresh(params.Values{
+		"action":  "query",
+		"prop":    "info",
+		"intoken": legacyName,
+		"titles":  "Main Page",
+	})
 	if err != nil {
 		return "", err
 	}
+	// These wikis do not support formatversion=2, so pages is an object
+	// keyed by page ID.
+	pages, err := resp.GetObject("query", "pages")
+	if err != nil {
+		return "", fmt.Errorf("invalid API response: no pages: %v", resp)
+	}
+	for _, page := range pages.Map() {
+		obj, err := page.Object()
+		if err != nil {
+			continue
+		}
+		if token, err := obj.GetString(legacyName + "token"); err == nil {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("invalid API response: no %s token: %v", legacyName, resp)
+}
+
+// knownTokens are the token types requested by RefreshAllTokens if the wiki
+// does not support requesting all token types with type=*.
+var knownTokens = []string{
+	CSRFToken,
+	DeleteGlobalAccountToken,
+	PatrolToken,
+	RollbackToken,
+	SetGlobalAccountStatusToken,
+	UserRightsToken,
+	WatchToken,
+}
 
-	token, err := resp.GetString("query", "tokens", tokenName+"token")
+// RefreshAllTokens obtains all the token types supported by the wiki
+// (except login tokens, which are always obtained fresh) in one request,
+// and stores them in the Client.Tokens map, replacing any cached tokens.
+// If the wiki does not support requesting all token types, the token types
+// known to this package are requested instead.
+func (w *Client) RefreshAllTokens() error {
+	p := params.Values{
+		"action":   "query",
+		"meta":     "tokens",
+		"type":     "*",
+		"continue": "",
+	}
+	resp, err := w.GetFresh(p)
+	if !w.storeTokens(resp) {
+		p.Del("type")
+		p.AddRange("type", knownTokens...)
+		resp, err = w.GetFresh(p)
+		if !w.storeTokens(resp) {
+			if err == nil {
+				err = fmt.Errorf("invalid API response: no tokens: %v", resp)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// storeTokens stores the tokens in a meta=tokens response in w.Tokens,
+// and reports whether the response contained any tokens.
+// Tokens of unsupported types cause API warnings, so resp is used even if
+// warnings were returned with it.
+func (w *Client) storeTokens(resp *jason.Object) bool {
+	if resp == nil {
+		return false
+	}
+	tokens, err := resp.GetObject("query", "tokens")
 	if err != nil {
-		// This really shouldn't happen.
-		return "", fmt.Errorf("error occured while converting token to string: %s", err)
+		return false
 	}
-	if tokenName != LoginToken {
+
+	w.tokensMu.Lock()
+	defer w.tokensMu.Unlock()
+	stored := false
+	for name, value := range tokens.Map() {
+		token, err := value.String()
+		tokenName := strings.TrimSuffix(name, "token")
+		if err != nil || tokenName == LoginToken {
+			continue
+		}
 		w.Tokens[tokenName] = token
+		stored = true
 	}
-	return token, nil
+	return stored
 }
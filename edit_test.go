@@ -1,10 +1,18 @@
 package mwclient
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"cgt.name/pkg/go-mwclient/params"
 )
@@ -43,6 +51,274 @@ func TestEdit(t *testing.T) {
 	}
 }
 
+func TestUndo(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "edit" {
+			t.Fatalf("action != edit: action=%s", v)
+		}
+		if v := r.Form.Get("undo"); v != "123" {
+			t.Fatalf("undo != 123: undo=%s", v)
+		}
+		if r.Form.Get("undoafter") != "" {
+			t.Fatalf("undoafter set despite being 0: %s", r.Form.Get("undoafter"))
+		}
+
+		fmt.Fprint(w, `{"error":{"code":"undofailure",
+		"info":"The edit could not be undone due to conflicting intermediate edits."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	err := client.Undo("PAGE", 123, 0, "")
+	if err != ErrUndoFailure {
+		t.Fatalf("expected ErrUndoFailure, got %v", err)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "edit" {
+			t.Fatalf("action != edit: action=%s", v)
+		}
+		if v := r.Form.Get("prependtext"); v != "{{header}}\n" {
+			t.Fatalf("prependtext != {{header}}\\n: prependtext=%s", v)
+		}
+		if v := r.Form.Get("appendtext"); v != "\n{{footer}}" {
+			t.Fatalf("appendtext != \\n{{footer}}: appendtext=%s", v)
+		}
+		if v := r.Form.Get("summary"); v != "wrap" {
+			t.Fatalf("summary != wrap: summary=%s", v)
+		}
+		if v := r.Form.Get("section"); v != "2" {
+			t.Fatalf("section != 2: section=%s", v)
+		}
+
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"PAGE",
+		"oldrevid":1,"newrevid":2,"newtimestamp":"2020-01-01T00:00:00Z"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	p := params.Values{"section": "2"}
+	if err := client.WrapText("PAGE", "{{header}}\n", "\n{{footer}}", "wrap", p); err != nil {
+		t.Fatalf("WrapText returned error: %v", err)
+	}
+	if reqCount != 1 {
+		t.Fatalf("expected 1 request, got %d", reqCount)
+	}
+}
+
+func TestEditSection(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("text"); v != "== Foo ==\nBar" {
+			t.Fatalf("text != == Foo ==\\nBar: text=%s", v)
+		}
+		if r.Form.Get("section") == "9" {
+			fmt.Fprint(w, `{"error":{"code":"nosuchsection","info":"There is no section 9."}}`)
+			return
+		}
+		if v := r.Form.Get("section"); v != "2" {
+			t.Fatalf("section != 2: section=%s", v)
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"PAGE",
+		"oldrevid":1,"newrevid":2,"newtimestamp":"2020-01-01T00:00:00Z"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if err := client.EditSection("PAGE", 2, "== Foo ==\nBar", "section"); err != nil {
+		t.Fatalf("EditSection returned error: %v", err)
+	}
+	if err := client.EditSection("PAGE", 9, "== Foo ==\nBar", "section"); err != ErrNoSuchSection {
+		t.Fatalf("expected ErrNoSuchSection, got %v", err)
+	}
+}
+
+func TestAppendPrependText(t *testing.T) {
+	var form url.Values
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		form = r.PostForm
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"PAGE",
+		"oldrevid":1,"newrevid":2,"newtimestamp":"2020-01-01T00:00:00Z"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if err := client.AppendText("PAGE", "\n{{footer}}", "append"); err != nil {
+		t.Fatalf("AppendText returned error: %v", err)
+	}
+	if v := form.Get("appendtext"); v != "\n{{footer}}" {
+		t.Fatalf("appendtext != \\n{{footer}}: appendtext=%s", v)
+	}
+	if _, ok := form["text"]; ok {
+		t.Fatalf("text sent with appendtext")
+	}
+
+	if err := client.PrependText("PAGE", "{{header}}\n", "prepend"); err != nil {
+		t.Fatalf("PrependText returned error: %v", err)
+	}
+	if v := form.Get("prependtext"); v != "{{header}}\n" {
+		t.Fatalf("prependtext != {{header}}\\n: prependtext=%s", v)
+	}
+	if _, ok := form["appendtext"]; ok {
+		t.Fatalf("appendtext sent with prependtext")
+	}
+}
+
+func TestEditTokenReuse(t *testing.T) {
+	tokenRequests := 0
+	edits := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("action") {
+		case "query":
+			tokenRequests++
+			fmt.Fprintf(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"token%d+\\"}}}`, tokenRequests)
+		case "edit":
+			edits++
+			if v := r.Form.Get("token"); v != fmt.Sprintf("token%d+\\", tokenRequests) {
+				t.Fatalf("edit sent with stale token: token=%s", v)
+			}
+			if edits == 2 {
+				// Simulate the session being renewed in between.
+				fmt.Fprint(w, `{"error":{"code":"badtoken","info":"Invalid CSRF token."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"PAGE",
+			"oldrevid":1,"newrevid":2,"newtimestamp":"2020-01-01T00:00:00Z"}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := client.Edit(params.Values{"title": "PAGE", "text": "text"}); err != nil {
+			t.Fatalf("edit %d failed: %v", i, err)
+		}
+	}
+	if tokenRequests != 2 {
+		t.Fatalf("expected 2 token requests, got %d", tokenRequests)
+	}
+	if edits != 3 {
+		t.Fatalf("expected 3 edit requests, got %d", edits)
+	}
+}
+
+func TestEditConflict(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("basetimestamp"); v != "2020-01-01T00:00:00Z" {
+			t.Fatalf("basetimestamp != 2020-01-01T00:00:00Z: basetimestamp=%s", v)
+		}
+		fmt.Fprint(w, `{"error":{"code":"editconflict","info":"Edit conflict."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	err := client.Edit(params.Values{
+		"title":         "PAGE",
+		"text":          "text",
+		"basetimestamp": "2020-01-01T00:00:00Z",
+	})
+	if err != ErrEditConflict {
+		t.Fatalf("expected ErrEditConflict, got %v", err)
+	}
+}
+
+func TestEditConflictCompetingEdits(t *testing.T) {
+	var mu sync.Mutex
+	timestamp := "2020-01-01T00:00:00Z"
+	revid := 1
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Form.Get("basetimestamp") != timestamp {
+			fmt.Fprint(w, `{"error":{"code":"editconflict","info":"Edit conflict."}}`)
+			return
+		}
+		revid++
+		timestamp = fmt.Sprintf("2020-01-01T00:00:%02dZ", revid)
+		fmt.Fprintf(w, `{"edit":{"result":"Success","pageid":1,"title":"PAGE",
+		"oldrevid":%d,"newrevid":%d,"newtimestamp":"%s"}}`, revid-1, revid, timestamp)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(httpHandler))
+	defer server.Close()
+	var clients [2]*Client
+	for i := range clients {
+		client, err := New(server.URL, "go-mwclient test")
+		if err != nil {
+			panic(err)
+		}
+		client.Tokens[CSRFToken] = "VALIDTOKEN"
+		clients[i] = client
+	}
+
+	// Both clients have read the page at the same revision.
+	base := timestamp
+	if err := clients[0].Edit(params.Values{"title": "PAGE", "text": "first", "basetimestamp": base}); err != nil {
+		t.Fatalf("first edit returned error: %v", err)
+	}
+	err := clients[1].Edit(params.Values{"title": "PAGE", "text": "second", "basetimestamp": base})
+	if err != ErrEditConflict {
+		t.Fatalf("expected ErrEditConflict for second edit, got %v", err)
+	}
+
+	// After reading the page again, the second edit can be retried.
+	mu.Lock()
+	base = timestamp
+	mu.Unlock()
+	if err := clients[1].Edit(params.Values{"title": "PAGE", "text": "second", "basetimestamp": base}); err != nil {
+		t.Fatalf("retried edit returned error: %v", err)
+	}
+}
+
 func TestGetToken(t *testing.T) {
 	resp := `{"batchcomplete":"","query":{"tokens":{"csrftoken":"+\\"}}}`
 	httpHandler := func(w http.ResponseWriter, r *http.Request) {
@@ -76,6 +352,140 @@ func TestGetToken(t *testing.T) {
 	}
 }
 
+func TestGetTokenConcurrent(t *testing.T) {
+	var reqCount int32
+	release := make(chan struct{})
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqCount, 1)
+		<-release
+		fmt.Fprint(w, `{"batchcomplete":"","query":{"tokens":{"csrftoken":"+\\"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := client.GetToken(CSRFToken)
+			if err != nil {
+				t.Errorf("token request failed: %v", err)
+			} else if token != "+\\" {
+				t.Errorf("received token does not match sent token: %s", token)
+			}
+		}()
+	}
+	// Give the goroutines time to wait for the token request.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&reqCount); n != 1 {
+		t.Fatalf("expected 1 token request, got %d", n)
+	}
+}
+
+func TestGetTokenConcurrentTypes(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("type"); v == "*" {
+			fmt.Fprint(w, `{"batchcomplete":"","query":{"tokens":{"csrftoken":"csrf+\\","watchtoken":"watch+\\"}}}`)
+		} else {
+			fmt.Fprintf(w, `{"batchcomplete":"","query":{"tokens":{"%stoken":"%s+\\"}}}`, v, v)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	tokenNames := []string{CSRFToken, PatrolToken, RollbackToken, WatchToken}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		tokenName := tokenNames[i%len(tokenNames)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := client.GetToken(tokenName)
+			if err != nil {
+				t.Errorf("token request failed: %v", err)
+			} else if token != tokenName+"+\\" {
+				t.Errorf("received %s token does not match sent token: %s", tokenName, token)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := client.RefreshAllTokens(); err != nil {
+			t.Errorf("RefreshAllTokens failed: %v", err)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestGetLegacyToken(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("type"); v != CSRFToken {
+			t.Fatalf("type != %s: type=%s", CSRFToken, v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"+\\"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	token, err := client.GetToken("edit")
+	if err != nil {
+		t.Fatalf("token request failed: %v", err)
+	}
+	if token != "+\\" || client.Tokens[CSRFToken] != token {
+		t.Fatalf("edit token not obtained as CSRF token: token=%s, Tokens=%v", token, client.Tokens)
+	}
+}
+
+func TestGetTokenLegacyWiki(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch {
+		case r.Form.Get("meta") == "tokens":
+			fmt.Fprint(w, `{"warnings":{"query":{"*":"Unrecognized value for parameter 'meta': tokens"}}}`)
+		case r.Form.Get("action") == "tokens":
+			fmt.Fprint(w, `{"error":{"code":"unknown_action","info":"Unrecognized value for parameter 'action': tokens"}}`)
+		case r.Form.Get("intoken") == "edit":
+			fmt.Fprint(w, `{"query":{"pages":{"1":{"pageid":1,"ns":0,"title":"Main Page",
+			"edittoken":"OLDTOKEN+\\"}}}}`)
+		default:
+			t.Fatalf("unexpected request: %s", r.Form.Encode())
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	token, err := client.GetToken(CSRFToken)
+	if err != nil {
+		t.Fatalf("token request failed: %v", err)
+	}
+	if token != "OLDTOKEN+\\" || client.Tokens[CSRFToken] != token {
+		t.Fatalf("legacy token not obtained: token=%s, Tokens=%v", token, client.Tokens)
+	}
+}
+
 func TestGetCachedToken(t *testing.T) {
 	client, err := New("http://example.com", "go-mwclient test")
 	if err != nil {
@@ -188,6 +598,82 @@ func TestEditCaptchaMath(t *testing.T) {
 	}
 }
 
+func TestEditCaptchaAnswer(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.PostForm.Get("captchaword") == "" {
+			// QuestyCaptcha returns the ID as a number.
+			fmt.Fprint(w, `{"edit":{"captcha":{"type":"question","mime":"text/html",`+
+				`"id":1234,"question":"What is the name of this wiki?"},"result":"Failure"}}`)
+			return
+		}
+		if r.PostForm.Get("captchaid") != "1234" || r.PostForm.Get("captchaword") != "Test Wiki" {
+			t.Errorf("unexpected answer: captchaid=%s, captchaword=%s",
+				r.PostForm.Get("captchaid"), r.PostForm.Get("captchaword"))
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"Sandbox","newrevid":2}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens["csrf"] = "doesn't matter"
+	p := params.Values{"title": "Sandbox", "text": "test"}
+	err := client.Edit(p)
+	e, ok := err.(CaptchaError)
+	if !ok {
+		t.Fatalf("error returned, but is not of type CaptchaError: %T", err)
+	}
+	if e.ID != "1234" {
+		t.Fatalf("CaptchaError.ID is not \"1234\": ID == %s", e.ID)
+	}
+
+	e.Answer(p, "Test Wiki")
+	if err := client.Edit(p); err != nil {
+		t.Fatalf("edit with CAPTCHA answer failed: %v", err)
+	}
+}
+
+func TestEditCaptchaSolver(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.PostForm.Get("captchaword") != "Test Wiki" {
+			fmt.Fprint(w, `{"edit":{"captcha":{"type":"question","mime":"text/html",`+
+				`"id":"5678","question":"What is the name of this wiki?"},"result":"Failure"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":1,"title":"Sandbox","newrevid":2}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens["csrf"] = "doesn't matter"
+	var questions []string
+	client.CaptchaSolver = func(captcha CaptchaError) (string, error) {
+		questions = append(questions, captcha.Question)
+		return "Test Wiki", nil
+	}
+	if err := client.Edit(params.Values{"title": "Sandbox", "text": "test"}); err != nil {
+		t.Fatalf("edit with CaptchaSolver failed: %v", err)
+	}
+	if len(questions) != 1 || questions[0] != "What is the name of this wiki?" {
+		t.Fatalf("CaptchaSolver not called once with the question: %v", questions)
+	}
+
+	// A wrong answer is not retried again.
+	client.CaptchaSolver = func(captcha CaptchaError) (string, error) {
+		return "wrong", nil
+	}
+	if _, ok := client.Edit(params.Values{"title": "Sandbox", "text": "test"}).(CaptchaError); !ok {
+		t.Fatalf("expected CaptchaError after wrong answer")
+	}
+}
+
 func TestHandleGetPagesReturnsPagesEvenIfWarning(t *testing.T) {
 	jsonResp := []byte(`
 {
@@ -282,3 +768,405 @@ func TestHandleGetPagesReturnsBothWarningsAndPageErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPageByName(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("titles") == "Missing" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"Missing","missing":true}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"normalized":[{"fromencoded":false,"from":"foo","to":"Foo"}],
+		"pages":[{"pageid":1,"ns":0,"title":"Foo","revisions":[{"timestamp":"2020-01-01T00:00:00Z",
+		"slots":{"main":{"contentmodel":"wikitext","content":"Text"}}}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	content, timestamp, err := client.GetPageByName("foo")
+	if err != nil {
+		t.Fatalf("GetPageByName returned error: %v", err)
+	}
+	if content != "Text" {
+		t.Fatalf("content != Text: content=%s", content)
+	}
+	if timestamp != "2020-01-01T00:00:00Z" {
+		t.Fatalf("timestamp != 2020-01-01T00:00:00Z: timestamp=%s", timestamp)
+	}
+
+	if _, _, err := client.GetPageByName("Missing"); err != ErrPageNotFound {
+		t.Fatalf("expected ErrPageNotFound, got %v", err)
+	}
+}
+
+func TestNormalizeContent(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"Foo",
+		"revisions":[{"timestamp":"2020-01-01T00:00:00Z",
+		"slots":{"main":{"contentmodel":"wikitext","content":"\ufeffLine 1\r\nLine 2"}}}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	content, _, err := client.GetPageByName("Foo")
+	if err != nil {
+		t.Fatalf("GetPageByName returned error: %v", err)
+	}
+	if content != "\ufeffLine 1\r\nLine 2" {
+		t.Fatalf("content not preserved: content=%q", content)
+	}
+
+	client.NormalizeContent = true
+	content, _, err = client.GetPageByName("Foo")
+	if err != nil {
+		t.Fatalf("GetPageByName returned error: %v", err)
+	}
+	if content != "Line 1\nLine 2" {
+		t.Fatalf("content not normalized: content=%q", content)
+	}
+}
+
+func TestGetRawWikitext(t *testing.T) {
+	brokenCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.URL.Path != "/w/index.php" {
+			t.Fatalf("path != /w/index.php: path=%s", r.URL.Path)
+		}
+		if v := r.Form.Get("action"); v != "raw" {
+			t.Fatalf("action != raw: action=%s", v)
+		}
+		if v := r.UserAgent(); !strings.HasPrefix(v, "go-mwclient test") {
+			t.Fatalf("user agent not set: User-Agent=%s", v)
+		}
+		if v := r.Form.Get("format"); v != "" {
+			t.Fatalf("API parameters sent to index.php: format=%s", v)
+		}
+
+		switch r.Form.Get("title") {
+		case "Missing":
+			http.NotFound(w, r)
+			return
+		case "Broken":
+			brokenCount++
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "Raw ''text''")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(httpHandler))
+	defer server.Close()
+	client, err := New(server.URL+"/w/api.php", "go-mwclient test")
+	if err != nil {
+		panic(err)
+	}
+
+	content, err := client.GetRawWikitext("Foo")
+	if err != nil {
+		t.Fatalf("GetRawWikitext returned error: %v", err)
+	}
+	if content != "Raw ''text''" {
+		t.Fatalf("content != Raw ''text'': content=%s", content)
+	}
+
+	if _, err := client.GetRawWikitext("Missing"); err != ErrPageNotFound {
+		t.Fatalf("expected ErrPageNotFound, got %v", err)
+	}
+
+	client.sleep = noSleep
+	client.Retries = 1
+	_, err = client.GetRawWikitext("Broken")
+	if httperr, ok := err.(HTTPError); !ok || httperr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected HTTPError with status 502, got %#v", err)
+	}
+	if brokenCount != 2 {
+		t.Fatalf("expected the request to be retried once, got %d requests", brokenCount)
+	}
+}
+
+func TestGetPageSlots(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("rvslots"); v != "main|mediainfo" {
+			t.Fatalf("rvslots != main|mediainfo: rvslots=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":6,"title":"File:Example.jpg",
+		"revisions":[{"slots":{"main":{"contentmodel":"wikitext","content":"Description"},
+		"mediainfo":{"contentmodel":"wikibase-mediainfo","content":"{\"type\":\"mediainfo\"}"}}}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	slots, err := client.GetPageSlots("File:Example.jpg", "main", "mediainfo")
+	if err != nil {
+		t.Fatalf("GetPageSlots returned error: %v", err)
+	}
+	if slots["main"] != "Description" {
+		t.Errorf("slots[main] != Description: slots[main]=%s", slots["main"])
+	}
+	if slots["mediainfo"] != `{"type":"mediainfo"}` {
+		t.Errorf(`slots[mediainfo] != {"type":"mediainfo"}: slots[mediainfo]=%s`, slots["mediainfo"])
+	}
+}
+
+func TestGetPageSlotsMissingSlot(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"Foo",
+		"revisions":[{"slots":{"main":{"contentmodel":"wikitext","content":"text"}}}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	_, err := client.GetPageSlots("Foo", "main", "mediainfo")
+	if err != ErrSlotNotFound {
+		t.Fatalf("expected ErrSlotNotFound, got %v", err)
+	}
+}
+
+func TestEditDryRun(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("request sent in dry run mode: %s", r.URL)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var buf bytes.Buffer
+	client.Logger = log.New(&buf, "", 0)
+	client.DryRun = true
+	err := client.Edit(params.Values{
+		"title": "PAGE",
+		"text":  "New text",
+	})
+	if err != nil {
+		t.Fatalf("Edit returned error in dry run mode: %v", err)
+	}
+	if !strings.Contains(buf.String(), "title=PAGE") {
+		t.Fatalf("dry run edit not logged: %s", buf.String())
+	}
+}
+
+func TestEditWithResult(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":42,"title":"PAGE",
+		"contentmodel":"wikitext","oldrevid":7936766,"newrevid":7950155,
+		"newtimestamp":"2015-02-12T17:13:01Z"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.EditWithResult(params.Values{"title": "PAGE", "text": "text"})
+	if err != nil {
+		t.Fatalf("EditWithResult returned error: %v", err)
+	}
+	expected := EditResult{
+		Result:       "Success",
+		PageID:       42,
+		Title:        "PAGE",
+		OldRevID:     7936766,
+		NewRevID:     7950155,
+		NewTimestamp: "2015-02-12T17:13:01Z",
+		ContentModel: "wikitext",
+	}
+	if result != expected {
+		t.Fatalf("result != expected: result=%+v", result)
+	}
+}
+
+func TestEditContentModel(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+		if r.PostForm.Get("contentmodel") != "json" || r.PostForm.Get("contentformat") != "application/json" {
+			t.Fatalf("unexpected content model and format: contentmodel=%s, contentformat=%s",
+				r.PostForm.Get("contentmodel"), r.PostForm.Get("contentformat"))
+		}
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":43,"title":"Config.json",
+		"contentmodel":"json","oldrevid":1,"newrevid":2}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	result, err := client.EditWithResult(params.Values{
+		"title":         "Config.json",
+		"text":          `{"enabled":true}`,
+		"contentmodel":  "json",
+		"contentformat": "application/json",
+	})
+	if err != nil {
+		t.Fatalf("EditWithResult returned error: %v", err)
+	}
+	if result.ContentModel != "json" {
+		t.Fatalf("ContentModel != json: ContentModel=%s", result.ContentModel)
+	}
+}
+
+func TestEditWithResultNoChange(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":42,"title":"PAGE",
+		"contentmodel":"wikitext","nochange":true}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	p := params.Values{"title": "PAGE", "text": "text"}
+	result, err := client.EditWithResult(p)
+	if err != nil {
+		t.Fatalf("EditWithResult returned error: %v", err)
+	}
+	if !result.NoChange || result.NewRevID != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if err := client.Edit(p); err != ErrEditNoChange {
+		t.Fatalf("expected ErrEditNoChange from Edit, got %v", err)
+	}
+}
+
+func TestEditWithResultNoChangeFormatVersion1(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"edit":{"result":"Success","pageid":42,"title":"PAGE",
+		"contentmodel":"wikitext","nochange":""}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	p := params.Values{"title": "PAGE", "text": "text", "formatversion": "1"}
+	result, err := client.EditWithResult(p)
+	if err != nil {
+		t.Fatalf("EditWithResult returned error: %v", err)
+	}
+	if !result.NoChange || result.New {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if err := client.Edit(p); err != ErrEditNoChange {
+		t.Fatalf("expected ErrEditNoChange from Edit, got %v", err)
+	}
+}
+
+func TestRefreshAllTokens(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("type") == "*" {
+			// Older wikis do not support type=*.
+			fmt.Fprint(w, `{"batchcomplete":true,"warnings":{"tokens":{"warnings":"Unrecognized value for parameter \"type\": *."}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"warnings":{"tokens":{"warnings":"Unrecognized values for parameter \"type\": deleteglobalaccount, setglobalaccountstatus."}},
+		"query":{"tokens":{"csrftoken":"csrf+\\","patroltoken":"patrol+\\","rollbacktoken":"rollback+\\","userrightstoken":"userrights+\\","watchtoken":"watch+\\"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "OLDTOKEN"
+	if err := client.RefreshAllTokens(); err != nil {
+		t.Fatalf("RefreshAllTokens returned error: %v", err)
+	}
+	if tok := client.Tokens[CSRFToken]; tok != "csrf+\\" {
+		t.Fatalf("csrf token not refreshed: %s", tok)
+	}
+	if len(client.Tokens) != 5 {
+		t.Fatalf("expected 5 tokens, got %d: %v", len(client.Tokens), client.Tokens)
+	}
+}
+
+func TestGetSectionContent(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("rvsection") {
+		case "2":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":1,"title":"Talk:Foo",
+			"revisions":[{"slots":{"main":{"contentmodel":"wikitext","content":"== Thread ==\nText"}}}]}]}}`)
+		default:
+			fmt.Fprint(w, `{"error":{"code":"nosuchsection","info":"There is no section 9."}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	content, err := client.GetSectionContent("Talk:Foo", 2)
+	if err != nil {
+		t.Fatalf("GetSectionContent returned error: %v", err)
+	}
+	if content != "== Thread ==\nText" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	if _, err := client.GetSectionContent("Talk:Foo", 9); err != ErrNoSuchSection {
+		t.Fatalf("expected ErrNoSuchSection, got %v", err)
+	}
+}
+
+func TestClearTokens(t *testing.T) {
+	tokenRequests := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("action") {
+		case "query":
+			tokenRequests++
+			fmt.Fprintf(w, `{"batchcomplete":true,"query":{"tokens":{"csrftoken":"token%d+\\"}}}`, tokenRequests)
+		case "logout":
+			fmt.Fprint(w, `{}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "OLDTOKEN"
+	client.ClearTokens()
+	if token, err := client.GetToken(CSRFToken); err != nil || token != "token1+\\" {
+		t.Fatalf("GetToken after ClearTokens = %q, %v; want a new token", token, err)
+	}
+
+	if err := client.Logout(); err != nil {
+		t.Fatalf("Logout returned error: %v", err)
+	}
+	if len(client.Tokens) != 0 {
+		t.Fatalf("tokens not cleared by Logout: %v", client.Tokens)
+	}
+	if token, err := client.GetToken(CSRFToken); err != nil || token != "token2+\\" {
+		t.Fatalf("GetToken after Logout = %q, %v; want a new token", token, err)
+	}
+}
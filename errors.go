@@ -4,19 +4,157 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
 )
 
 // APIError represents a MediaWiki API error.
+// Errors with some codes are returned as more specific types that embed
+// APIError (e.g., PermissionError). errors.As can be used to get the APIError
+// of any error returned by the API:
+//
+//	var apierr mwclient.APIError
+//	if errors.As(err, &apierr) && apierr.Code == "ratelimited" {
+//		// ...
+//	}
 type APIError struct {
 	Code, Info string
+	// RequestID is the ID of the request that caused the error, if the
+	// request was sent with one (see Client.RequestIDs).
+	RequestID string
 }
 
 func (e APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s: %s (request ID %s)", e.Code, e.Info, e.RequestID)
+	}
 	return fmt.Sprintf("%s: %s", e.Code, e.Info)
 }
 
+// AssertionError is returned when the API rejects a request because an
+// assertion made by the client (see Client.Assert and Client.AssertUsername)
+// failed.
+// This usually means that the client has been logged out or is logged in as
+// a different user than expected.
+type AssertionError struct {
+	APIError
+}
+
+// PermissionError is returned when the API rejects a request because the
+// user does not have the permissions required to perform it.
+type PermissionError struct {
+	APIError
+}
+
+// AuthExpiredError is returned when the API rejects the OAuth credentials
+// of a request, e.g. because the access token has been revoked or the grant
+// has expired. Retrying the request will not help; the user has to
+// authorize the application again.
+type AuthExpiredError struct {
+	APIError
+}
+
+// Unwrap returns the embedded APIError, so that errors.As can be used to get
+// the APIError of an AssertionError.
+func (e AssertionError) Unwrap() error { return e.APIError }
+
+// Unwrap returns the embedded APIError, so that errors.As can be used to get
+// the APIError of a PermissionError.
+func (e PermissionError) Unwrap() error { return e.APIError }
+
+// Unwrap returns the embedded APIError, so that errors.As can be used to get
+// the APIError of an AuthExpiredError.
+func (e AuthExpiredError) Unwrap() error { return e.APIError }
+
+// AbuseFilterError is returned when an edit or other action is rejected by
+// the AbuseFilter extension (error code "abusefilter-disallowed" or
+// "abusefilter-warning"). For "abusefilter-warning", repeating the exact same
+// request will usually succeed, as the filter only warns once.
+type AbuseFilterError struct {
+	APIError
+	// FilterID is the ID of the filter that matched the action.
+	FilterID string
+	// Description is the public description of the filter.
+	Description string
+	// Actions are the actions the filter took, e.g. "disallow" or "warn".
+	Actions []string
+}
+
+// Unwrap returns the embedded APIError, so that errors.As can be used to get
+// the APIError of an AbuseFilterError.
+func (e AbuseFilterError) Unwrap() error { return e.APIError }
+
+// abuseFilterError returns e as an AbuseFilterError if it is an AbuseFilter
+// rejection, filling in the filter details from the "abusefilter" object in
+// data, if present. Otherwise, e is returned as classified by
+// classifyAPIError.
+func abuseFilterError(e APIError, data *jason.Object) error {
+	if e.Code != "abusefilter-disallowed" && e.Code != "abusefilter-warning" {
+		return classifyAPIError(e)
+	}
+
+	aferr := AbuseFilterError{APIError: e}
+	if data == nil {
+		return aferr
+	}
+	af, err := data.GetObject("abusefilter")
+	if err != nil {
+		return aferr
+	}
+	if id, err := af.GetString("id"); err == nil {
+		aferr.FilterID = id
+	} else if id, err := af.GetInt64("id"); err == nil {
+		aferr.FilterID = strconv.FormatInt(id, 10)
+	}
+	aferr.Description, _ = af.GetString("description")
+	if actions, err := af.GetStringArray("actions"); err == nil {
+		aferr.Actions = actions
+	}
+	return aferr
+}
+
+// classifyAPIError returns e as a more specific error type if its code
+// is one that the package has a dedicated type for. Otherwise, e is returned.
+func classifyAPIError(e APIError) error {
+	switch e.Code {
+	case "assertuserfailed", "assertbotfailed", "assertnameduserfailed":
+		return AssertionError{e}
+	case "permissiondenied", "readapidenied", "writeapidenied", "noapiwrite",
+		"protectedpage", "cascadeprotected", "cantcreate", "cantundelete":
+		return PermissionError{e}
+	}
+	if strings.HasPrefix(e.Code, "mwoauth-invalid-authorization") {
+		return AuthExpiredError{e}
+	}
+	return e
+}
+
+// apiError is used to recognize APIError and the error types embedding it.
+func (e APIError) apiError() APIError { return e }
+
+// isTransient reports whether err is an error that may not occur again if
+// the request is retried, i.e. any non-nil error that was not returned by
+// the API in a response.
+func isTransient(err error) bool {
+	if err == nil || err == ErrAPIBusy {
+		return false
+	}
+	switch err.(type) {
+	case interface{ apiError() APIError }, APIWarnings, CaptchaError, UnknownModuleError:
+		return false
+	case HTTPError:
+		code := err.(HTTPError).StatusCode
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
+
 // APIWarnings represents a collection of MediaWiki API warnings.
 type APIWarnings []struct {
 	Module, Info string
@@ -39,6 +177,58 @@ func (w APIWarnings) Error() string {
 	return buf.String()
 }
 
+// Messages returns the warnings as messages of the form "module: text". In
+// the bc error format, the API returns all warnings from a module in one
+// string separated by newlines; such warnings are split into one message per
+// line.
+func (w APIWarnings) Messages() []string {
+	var messages []string
+	for _, warn := range w {
+		for _, line := range strings.Split(warn.Info, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				messages = append(messages, warn.Module+": "+line)
+			}
+		}
+	}
+	return messages
+}
+
+// Warnings returns the warnings in the API response resp as messages of the
+// form "module: text" (see APIWarnings.Messages), or nil if it contains no
+// warnings. It is useful for responses obtained without the warnings being
+// checked, e.g. with GetRaw, and works with all error formats and both
+// formatversions. Methods such as Get return the same warnings as an
+// APIWarnings error.
+func Warnings(resp *jason.Object) []string {
+	v, err := resp.GetValue("warnings")
+	if err != nil {
+		return nil
+	}
+	var warnings error
+	if obj, err := v.Object(); err == nil {
+		warnings = extractWarnings(obj)
+	} else if arr, err := v.ObjectArray(); err == nil {
+		warnings = extractWarningsArray(arr)
+	}
+	if w, ok := warnings.(APIWarnings); ok {
+		return w.Messages()
+	}
+	return nil
+}
+
+// reportDeprecations calls f for each deprecation warning in warnings.
+// In the bc error format, all warnings from a module are returned in one
+// string separated by newlines, so they are checked line by line.
+func reportDeprecations(warnings APIWarnings, f func(module, message string)) {
+	for _, warn := range warnings {
+		for _, line := range strings.Split(warn.Info, "\n") {
+			if strings.Contains(strings.ToLower(line), "deprecat") {
+				f(warn.Module, line)
+			}
+		}
+	}
+}
+
 // CaptchaError represents the error returned by the API when it requires the
 // client to solve a CAPTCHA to perform the action requested.
 type CaptchaError struct {
@@ -63,6 +253,112 @@ func (e CaptchaError) Error() string {
 	}
 }
 
+// Answer sets the parameters in p that submit answer as the solution to the
+// CAPTCHA. Resending the request that returned the CaptchaError with these
+// parameters retries it with the CAPTCHA solved:
+//
+//	p := params.Values{"title": "Sandbox", "text": text}
+//	_, err := w.EditWithResult(p)
+//	if captcha, ok := err.(mwclient.CaptchaError); ok {
+//		captcha.Answer(p, askUser(captcha))
+//		_, err = w.EditWithResult(p)
+//	}
+func (e CaptchaError) Answer(p params.Values, answer string) {
+	p.Set("captchaid", e.ID)
+	p.Set("captchaword", answer)
+}
+
+// newCaptchaError creates a CaptchaError from a "captcha" object in an API
+// response. Depending on the CAPTCHA type and the ConfirmEdit version, the ID
+// may be returned as a string or as a number, and the type and MIME type may
+// be missing.
+func newCaptchaError(captcha *jason.Object) CaptchaError {
+	var e CaptchaError
+	e.Type, _ = captcha.GetString("type")
+	e.Mime, _ = captcha.GetString("mime")
+	if id, err := captcha.GetString("id"); err == nil {
+		e.ID = id
+	} else if id, err := captcha.GetNumber("id"); err == nil {
+		e.ID = id.String()
+	}
+	e.URL, _ = captcha.GetString("url")
+	e.Question, _ = captcha.GetString("question")
+	return e
+}
+
+// UnknownModuleError is returned by helper methods when the API does not
+// recognize a module that they depend on. This usually means that the
+// extension providing the module is not installed on the wiki.
+type UnknownModuleError struct {
+	// Param is the parameter used to select the module, e.g. "prop".
+	Param string
+	// Module is the name of the module, e.g. "globalusage".
+	Module string
+}
+
+func (e UnknownModuleError) Error() string {
+	return fmt.Sprintf("API module %s=%s is not available (is the extension installed?)",
+		e.Param, e.Module)
+}
+
+// checkModule returns an UnknownModuleError if err is an API error or warning
+// saying that module is not a recognized value for the parameter param.
+// Otherwise, err is returned unchanged.
+func checkModule(err error, param, module string) error {
+	unrecognized := func(info string) bool {
+		return strings.Contains(info, "Unrecognized value for parameter") &&
+			// Parameter names are quoted with single quotes by older
+			// versions of MediaWiki.
+			(strings.Contains(info, `"`+param+`"`) || strings.Contains(info, "'"+param+"'")) &&
+			strings.Contains(info, module)
+	}
+
+	switch e := err.(type) {
+	case APIError:
+		if (param == "action" && e.Code == "unknown_action") ||
+			(e.Code == "badvalue" && unrecognized(e.Info)) {
+			return UnknownModuleError{param, module}
+		}
+	case APIWarnings:
+		for _, warn := range e {
+			if unrecognized(warn.Info) {
+				return UnknownModuleError{param, module}
+			}
+		}
+	}
+	return err
+}
+
+// HTTPError is returned when the server responds to an API request with an
+// HTTP status code other than 2xx, e.g. when a reverse proxy in front of the
+// wiki returns an HTML error page.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// Body is the beginning of the response body (at most
+	// httpErrorBodyLimit bytes).
+	Body string
+	// RetryAfter is the number of seconds the server asked to wait before
+	// retrying the request, as specified in the Retry-After header of 429 Too
+	// Many Requests and 503 Service Unavailable responses. It is 0 if the
+	// header was not set.
+	RetryAfter int
+}
+
+func (e HTTPError) Error() string {
+	msg := fmt.Sprintf("HTTP error: %s", e.Status)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %d seconds)", e.RetryAfter)
+	}
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// httpErrorBodyLimit is the maximum length of HTTPError.Body.
+const httpErrorBodyLimit = 512
+
 // maxLagError is returned by the callf closure in the Client.call method when
 // there is too much lag on the MediaWiki site. maxLagError contains a message
 // from the server in the format "Waiting for $host: $lag seconds lagged\n" and
@@ -89,27 +385,71 @@ var ErrNoArgs = errors.New("no arguments passed")
 // *jason.Object. If it finds an error, it will return an APIError.
 // Otherwise it will look for warnings, and if it finds any it will return
 // it/them in an APIWarning.
-// extractAPIErrors is not compatible with MWAPI formatversion=1.
+// extractAPIErrors supports responses in both MWAPI formatversion=1 and
+// formatversion=2, as well as the error formats selected with the
+// errorformat parameter.
 func extractAPIErrors(resp *jason.Object) error {
+	requestID, _ := resp.GetString("requestid")
+
 	if e, err := resp.GetObject("error"); err == nil {
+		// errorformat=bc (the default)
 		code, err1 := e.GetString("code")
 		info, err2 := e.GetString("info")
+		if err2 != nil {
+			info, err2 = e.GetString("*")
+		}
 		if !(err1 == nil && err2 == nil) {
 			return fmt.Errorf("extractAPIErrors: 'error' object does not contain expected 'code' and 'info': %v", e)
 		}
-		return APIError{
-			Code: code,
-			Info: info,
+		return abuseFilterError(APIError{
+			Code:      code,
+			Info:      info,
+			RequestID: requestID,
+		}, e)
+	}
+
+	if errs, err := resp.GetObjectArray("errors"); err == nil && len(errs) > 0 {
+		// errorformat=plaintext, wikitext, html, or raw
+		code, err := errs[0].GetString("code")
+		if err != nil {
+			return fmt.Errorf("extractAPIErrors: 'errors' object does not contain expected 'code': %v", errs[0])
 		}
+		data, _ := errs[0].GetObject("data")
+		return abuseFilterError(APIError{
+			Code:      code,
+			Info:      messageText(errs[0]),
+			RequestID: requestID,
+		}, data)
 	}
 
-	if w, err := resp.GetObject("warnings"); err == nil {
-		return extractWarnings(w)
+	if w, err := resp.GetValue("warnings"); err == nil {
+		if obj, err := w.Object(); err == nil {
+			return extractWarnings(obj)
+		}
+		if arr, err := w.ObjectArray(); err == nil {
+			return extractWarningsArray(arr)
+		}
+		return fmt.Errorf("extractAPIErrors: unrecognized 'warnings' value: %v", w.Interface())
 	}
 
 	return nil
 }
 
+// messageText returns the text of an error or warning message object
+// returned with errorformat set to something other than bc.
+// The key of the text depends on the error format and formatversion.
+func messageText(msg *jason.Object) string {
+	for _, key := range []string{"text", "html", "*", "key"} {
+		if text, err := msg.GetString(key); err == nil {
+			return text
+		}
+	}
+	return ""
+}
+
+// extractWarnings extracts warnings from a 'warnings' object in the default
+// (bc) error format, which maps module names to objects containing the
+// warning text.
 func extractWarnings(resp *jason.Object) error {
 	var warnings APIWarnings
 	for module, warningValue := range resp.Map() {
@@ -118,12 +458,35 @@ func extractWarnings(resp *jason.Object) error {
 			return fmt.Errorf("extractWarnings: %v: %v", err, warningValue)
 		}
 
+		// The text is in "warnings" with formatversion=2 and in "*" with
+		// formatversion=1.
 		info, err := warning.GetString("warnings")
+		if err != nil {
+			info, err = warning.GetString("*")
+		}
 		if err != nil {
 			return fmt.Errorf("extractWarnings: %v: %v", err, warning)
 		}
 		warnings = append(warnings, APIWarnings{{module, info}}...)
 	}
+	// Map iteration order is random; sort by module for stable messages.
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Module < warnings[j].Module })
+
+	return warnings
+}
+
+// extractWarningsArray extracts warnings from a 'warnings' array, which is
+// returned when errorformat is set to something other than bc.
+func extractWarningsArray(resp []*jason.Object) error {
+	if len(resp) == 0 {
+		return nil
+	}
+
+	var warnings APIWarnings
+	for _, warning := range resp {
+		module, _ := warning.GetString("module")
+		warnings = append(warnings, APIWarnings{{module, messageText(warning)}}...)
+	}
 
 	return warnings
 }
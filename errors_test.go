@@ -1,6 +1,8 @@
 package mwclient
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/antonholmquist/jason"
@@ -37,6 +39,24 @@ func TestExtractAPIErrors(t *testing.T) {
 			Warn,
 			1,
 		},
+		{
+			// formatversion=1
+			[]byte(`{"warnings":{"main":{"*":"Unrecognized parameter: foo."},"query":{"*":"Unrecognized value for parameter \"list\": invalidmodule."}}}`),
+			Warn,
+			2,
+		},
+		{
+			// errorformat=plaintext
+			[]byte(`{"errors":[{"code":"badvalue","text":"Unrecognized value for parameter \"list\": invalidmodule.","module":"query"}]}`),
+			Eror,
+			0,
+		},
+		{
+			// errorformat=plaintext
+			[]byte(`{"batchcomplete":true,"warnings":[{"code":"unrecognizedparams","text":"Unrecognized parameter: foo.","module":"main"}]}`),
+			Warn,
+			1,
+		},
 		{
 			[]byte(`{"query":{"pages":{"709377":{"pageid":709377,"ns":2,"title":
 			"Bruger:Cgtdk","contentmodel":"wikitext","pagelanguage":"da",
@@ -76,3 +96,85 @@ func TestExtractAPIErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		json string
+		want []string
+	}{
+		// formatversion=1
+		{`{"warnings":{"query":{"*":"Unrecognized value for parameter \"list\": invalidmodule."},
+		"main":{"*":"Unrecognized parameter: foo.\nSubscribe to the mediawiki-api-announce mailing list."}}}`,
+			[]string{"main: Unrecognized parameter: foo.",
+				"main: Subscribe to the mediawiki-api-announce mailing list.",
+				`query: Unrecognized value for parameter "list": invalidmodule.`}},
+		// formatversion=2
+		{`{"batchcomplete":true,"warnings":{"main":{"warnings":"Unrecognized parameter: foo."}}}`,
+			[]string{"main: Unrecognized parameter: foo."}},
+		// errorformat=plaintext
+		{`{"batchcomplete":true,"warnings":[{"code":"unrecognizedparams","text":"Unrecognized parameter: foo.","module":"main"}]}`,
+			[]string{"main: Unrecognized parameter: foo."}},
+		{`{"batchcomplete":true,"query":{}}`, nil},
+	}
+
+	for i, test := range tests {
+		j, err := jason.NewObjectFromBytes([]byte(test.json))
+		if err != nil {
+			panic("Invalid test data: bad JSON input")
+		}
+		if got := Warnings(j); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("(test:%d) Warnings() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestAPIErrorAs(t *testing.T) {
+	for _, code := range []string{"ratelimited", "permissiondenied", "assertnameduserfailed",
+		"mwoauth-invalid-authorization-invalid-user"} {
+		err := classifyAPIError(APIError{Code: code, Info: "info"})
+		var apierr APIError
+		if !errors.As(err, &apierr) {
+			t.Errorf("errors.As failed for %T", err)
+		} else if apierr.Code != code {
+			t.Errorf("apierr.Code != %s: apierr.Code=%s", code, apierr.Code)
+		}
+	}
+}
+
+func TestAssertionError(t *testing.T) {
+	for _, code := range []string{"assertuserfailed", "assertbotfailed", "assertnameduserfailed"} {
+		if _, ok := classifyAPIError(APIError{Code: code}).(AssertionError); !ok {
+			t.Errorf("%s is not returned as AssertionError", code)
+		}
+	}
+}
+
+func TestAbuseFilterError(t *testing.T) {
+	for _, body := range []string{
+		`{"error":{"code":"abusefilter-disallowed","info":"This action has been disallowed.",` +
+			`"abusefilter":{"id":"4","description":"Page blanking","actions":["disallow"]}}}`,
+		`{"errors":[{"code":"abusefilter-disallowed","text":"This action has been disallowed.",` +
+			`"data":{"abusefilter":{"id":4,"description":"Page blanking","actions":["disallow"]}}}]}`,
+	} {
+		resp, err := jason.NewObjectFromBytes([]byte(body))
+		if err != nil {
+			panic(err)
+		}
+		aferr, ok := extractAPIErrors(resp).(AbuseFilterError)
+		if !ok {
+			t.Fatalf("expected AbuseFilterError, got %T", extractAPIErrors(resp))
+		}
+		if aferr.FilterID != "4" {
+			t.Fatalf("FilterID != 4: FilterID=%s", aferr.FilterID)
+		}
+		if aferr.Description != "Page blanking" {
+			t.Fatalf("Description != Page blanking: Description=%s", aferr.Description)
+		}
+		if len(aferr.Actions) != 1 || aferr.Actions[0] != "disallow" {
+			t.Fatalf("Actions != [disallow]: Actions=%v", aferr.Actions)
+		}
+		if aferr.Code != "abusefilter-disallowed" {
+			t.Fatalf("Code != abusefilter-disallowed: Code=%s", aferr.Code)
+		}
+	}
+}
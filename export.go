@@ -0,0 +1,124 @@
+package mwclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// exportChunkSize is the maximum amount of titles exported in one request
+// by Export.
+const exportChunkSize = 50
+
+// Export returns the latest revisions of the pages titles in the XML export
+// format of MediaWiki (as used by Special:Export and XML dumps), using
+// action=query&export. The export is streamed from the API as it is read,
+// so it is not kept in memory. The caller must close it when done with it.
+// The pages are exported in chunks of 50 titles per request, each of which
+// is a separate XML document; if more than 50 titles are given, the returned
+// stream consists of several XML documents one after another. Requests for
+// further chunks are made when the previous document has been read.
+// Errors for later chunks are returned by Read.
+func (w *Client) Export(titles []string) (io.ReadCloser, error) {
+	if len(titles) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	r := &exportReader{w: w, chunks: chunk(titles, exportChunkSize)}
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// exportReader reads the XML exports of chunks of titles one after another.
+type exportReader struct {
+	w      *Client
+	chunks [][]string
+	cur    io.ReadCloser
+}
+
+// next starts the export of the next chunk.
+func (r *exportReader) next() error {
+	cur, err := r.w.exportChunk(r.chunks[0])
+	if err != nil {
+		return err
+	}
+	r.chunks = r.chunks[1:]
+	r.cur = cur
+	return nil
+}
+
+func (r *exportReader) Read(b []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			if err := r.next(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.cur.Read(b)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *exportReader) Close() error {
+	r.chunks = nil
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+// exportChunk requests the XML export of titles and returns the response body.
+// API errors are returned as errors instead.
+func (w *Client) exportChunk(titles []string) (io.ReadCloser, error) {
+	p := params.Values{
+		"action":       "query",
+		"export":       "",
+		"exportnowrap": "",
+	}
+	p.AddRange("titles", titles...)
+
+	// The export is streamed, so it must not be buffered by the cache.
+	body, err := w.callWithOptions(p, callOptions{fresh: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors are returned as JSON instead of XML.
+	br := bufio.NewReader(body)
+	if b, err := br.Peek(1); err == nil && b[0] == '{' {
+		defer body.Close()
+		resp, err := jason.NewObjectFromReader(br)
+		if err != nil {
+			return nil, err
+		}
+		if err := extractAPIErrors(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid API response: no XML export: %v", resp)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, body}, nil
+}
@@ -0,0 +1,69 @@
+package mwclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if _, ok := r.Form["export"]; !ok {
+			t.Fatalf("export not set")
+		}
+		if _, ok := r.Form["exportnowrap"]; !ok {
+			t.Fatalf("exportnowrap not set")
+		}
+
+		titles := strings.Split(r.Form.Get("titles"), "|")
+		if len(titles) > exportChunkSize {
+			t.Fatalf("too many titles in one request: %d", len(titles))
+		}
+		fmt.Fprintf(w, "<mediawiki><page><title>%s</title></page></mediawiki>\n", titles[0])
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	titles := make([]string, exportChunkSize+1)
+	for i := range titles {
+		titles[i] = fmt.Sprintf("Page %d", i)
+	}
+	r, err := client.Export(titles)
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	defer r.Close()
+
+	xml, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading export: %v", err)
+	}
+	want := "<mediawiki><page><title>Page 0</title></page></mediawiki>\n" +
+		"<mediawiki><page><title>Page 50</title></page></mediawiki>\n"
+	if string(xml) != want {
+		t.Fatalf("unexpected export: %s", xml)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"readapidenied","info":"You need read permission to use this module."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if _, err := client.Export([]string{"Foo"}); err == nil {
+		t.Fatalf("expected error, got nil")
+	} else if _, ok := err.(PermissionError); !ok {
+		t.Fatalf("expected PermissionError, got %T: %v", err, err)
+	}
+}
@@ -0,0 +1,474 @@
+package mwclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// This file contains helpers for API modules provided by MediaWiki
+// extensions. If the extension is not installed on the wiki, the helpers
+// return an UnknownModuleError.
+
+// GlobalUse is a page on some wiki that uses a file from a shared
+// file repository (such as Wikimedia Commons).
+type GlobalUse struct {
+	Title string `json:"title"`
+	Wiki  string `json:"wiki"`
+	URL   string `json:"url"`
+}
+
+// GlobalUsage returns the pages on all wikis that use the given file
+// (e.g., "File:Example.jpg"). GlobalUsage requires the GlobalUsage extension,
+// which is installed on shared file repositories such as Wikimedia Commons.
+func (w *Client) GlobalUsage(file string) ([]GlobalUse, error) {
+	p := params.Values{
+		"prop":    "globalusage",
+		"titles":  file,
+		"guprop":  "url",
+		"gulimit": "max",
+	}
+
+	var uses []GlobalUse
+	err := w.queryEach(p, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				Pages []struct {
+					GlobalUsage []GlobalUse `json:"globalusage"`
+				} `json:"pages"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, page := range r.Query.Pages {
+			uses = append(uses, page.GlobalUsage...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, checkModule(err, "prop", "globalusage")
+	}
+
+	return uses, nil
+}
+
+// CirrusDoc returns the CirrusSearch (Elasticsearch) documents indexed for
+// the page title. There is usually one document per search cluster.
+// CirrusDoc requires the CirrusSearch extension.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) CirrusDoc(title string) ([]*jason.Object, error) {
+	p := params.Values{
+		"action": "query",
+		"prop":   "cirrusdoc",
+		"titles": title,
+	}
+
+	resp, err := w.Get(p)
+	if err != nil {
+		return nil, checkModule(err, "prop", "cirrusdoc")
+	}
+
+	pages, err := resp.GetObjectArray("query", "pages")
+	if err != nil || len(pages) == 0 {
+		return nil, fmt.Errorf("invalid API response: no pages: %v", resp)
+	}
+	if missing, err := pages[0].GetBoolean("missing"); err == nil && missing {
+		return nil, ErrPageNotFound
+	}
+
+	docs, err := pages[0].GetObjectArray("cirrusdoc")
+	if err != nil {
+		return nil, fmt.Errorf("invalid API response: no cirrusdoc: %v", pages[0])
+	}
+	return docs, nil
+}
+
+// ShortDescription returns the short description of the page title
+// (prop=description) and its source, which is "local" if it is set on the
+// page with the SHORTDESC magic word or "central" if it comes from the
+// connected Wikibase item (e.g., on Wikidata). If the page has no short
+// description, two empty strings are returned.
+// ShortDescription requires the WikibaseClient or ShortDescription extension.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) ShortDescription(title string) (description, source string, err error) {
+	p := params.Values{
+		"action": "query",
+		"prop":   "description",
+		"titles": title,
+	}
+
+	resp, err := w.Get(p)
+	if err != nil {
+		return "", "", checkModule(err, "prop", "description")
+	}
+
+	var r struct {
+		Query struct {
+			Pages []struct {
+				Missing           bool   `json:"missing"`
+				Description       string `json:"description"`
+				DescriptionSource string `json:"descriptionsource"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return "", "", err
+	}
+	if len(r.Query.Pages) == 0 {
+		return "", "", fmt.Errorf("invalid API response: no pages: %v", resp)
+	}
+	page := r.Query.Pages[0]
+	if page.Missing {
+		return "", "", ErrPageNotFound
+	}
+	return page.Description, page.DescriptionSource, nil
+}
+
+// EntityUsage returns the Wikibase entities (e.g., Wikidata items) used by
+// the page title, mapped to the aspects of each entity that the page uses.
+// Aspects are returned as the codes used by Wikibase, e.g. "S" (sitelinks),
+// "L.en" (English label), "T" (title), or "C.P31" (statements of property P31).
+// EntityUsage requires the WikibaseClient extension.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) EntityUsage(title string) (map[string][]string, error) {
+	p := params.Values{
+		"prop":      "wbentityusage",
+		"titles":    title,
+		"wbeulimit": "max",
+	}
+
+	usage := map[string][]string{}
+	err := w.queryEach(p, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				Pages []struct {
+					Missing bool `json:"missing"`
+					Usage   map[string]struct {
+						Aspects []string `json:"aspects"`
+					} `json:"wbentityusage"`
+				} `json:"pages"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, page := range r.Query.Pages {
+			if page.Missing {
+				return ErrPageNotFound
+			}
+			for entity, u := range page.Usage {
+				usage[entity] = append(usage[entity], u.Aspects...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, checkModule(err, "prop", "wbentityusage")
+	}
+
+	return usage, nil
+}
+
+// spamBlacklistChunkSize is the maximum amount of URLs checked in
+// one spamblacklist request.
+const spamBlacklistChunkSize = 50
+
+// CheckSpamBlacklist checks whether the urls would be rejected by the spam
+// blacklist if added to a page (action=spamblacklist). It returns a map of
+// the input URLs to whether they are blacklisted. The URLs are checked in
+// chunks of 50 URLs per request.
+// CheckSpamBlacklist requires the SpamBlacklist extension.
+func (w *Client) CheckSpamBlacklist(urls []string) (map[string]bool, error) {
+	if len(urls) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	results := make(map[string]bool, len(urls))
+	for _, chunk := range chunk(urls, spamBlacklistChunkSize) {
+		p := params.Values{"action": "spamblacklist"}
+		p.AddRange("url", chunk...)
+
+		resp, err := w.Post(p)
+		if err != nil {
+			return nil, checkModule(err, "action", "spamblacklist")
+		}
+
+		var r struct {
+			SpamBlacklist struct {
+				Result  string   `json:"result"`
+				Matches []string `json:"matches"`
+			} `json:"spamblacklist"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return nil, err
+		}
+
+		// The API only reports the matching parts of the URLs, so they
+		// have to be mapped back to the URL they were found in.
+		for _, url := range chunk {
+			results[url] = false
+			for _, match := range r.SpamBlacklist.Matches {
+				if strings.Contains(strings.ToLower(url), strings.ToLower(match)) {
+					results[url] = true
+					break
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// Campaign is a CentralNotice campaign, as returned by ActiveCampaigns.
+type Campaign struct {
+	Name string `json:"name"`
+	// Start and End are timestamps in the MediaWiki format (YYYYMMDDHHMMSS).
+	Start   string   `json:"start"`
+	End     string   `json:"end"`
+	Banners []string `json:"banners"`
+	// Countries is only set for geotargeted campaigns.
+	Countries []string `json:"countries"`
+}
+
+// ActiveCampaigns returns the CentralNotice campaigns that are currently
+// active (list=centralnoticeactivecampaigns). If includeFuture is true,
+// campaigns that are scheduled to start in the future are included.
+// ActiveCampaigns requires the CentralNotice extension.
+func (w *Client) ActiveCampaigns(includeFuture bool) ([]Campaign, error) {
+	p := params.Values{
+		"action": "query",
+		"list":   "centralnoticeactivecampaigns",
+	}
+	if includeFuture {
+		p.Set("cnacincludefuture", "")
+	}
+
+	resp, err := w.Get(p)
+	if err != nil {
+		return nil, checkModule(err, "list", "centralnoticeactivecampaigns")
+	}
+
+	var r struct {
+		Query struct {
+			Active struct {
+				Campaigns []Campaign `json:"campaigns"`
+			} `json:"centralnoticeactivecampaigns"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+	return r.Query.Active.Campaigns, nil
+}
+
+// BannerChoices returns the CentralNotice campaigns, and their banners, that
+// may be shown to users of the given project (e.g., "wikipedia") and language
+// (action=centralnoticechoicedata). The campaigns are returned as returned by
+// the API, because their structure depends on the version of CentralNotice.
+// BannerChoices requires the CentralNotice extension.
+func (w *Client) BannerChoices(project, language string) ([]*jason.Object, error) {
+	p := params.Values{
+		"action":   "centralnoticechoicedata",
+		"project":  project,
+		"language": language,
+	}
+
+	resp, err := w.Get(p)
+	if err != nil {
+		return nil, checkModule(err, "action", "centralnoticechoicedata")
+	}
+
+	choices, err := resp.GetObjectArray("choices")
+	if err != nil {
+		return nil, fmt.Errorf("invalid API response: no choices: %v", resp)
+	}
+	return choices, nil
+}
+
+// Notifications returns the Echo notifications of the logged-in user
+// (meta=notifications). p can contain additional parameters for the module,
+// e.g. notfilter=!read to only get unread notifications or notsections=message
+// to only get notices about talk page messages. If types are given, only
+// notifications of those types (e.g., "mention" or "edit-user-talk") are
+// returned.
+// cont is the continuation value for the next notifications; to get them,
+// call Notifications again with notcontinue set to cont in p. It is empty if
+// there are no more notifications.
+// Notifications requires the Echo extension.
+func (w *Client) Notifications(p params.Values, types ...string) (notifications []*jason.Object, cont string, err error) {
+	q := params.Values{
+		"action": "query",
+		"meta":   "notifications",
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+
+	resp, err := w.Get(q)
+	if err != nil {
+		return nil, "", checkModule(err, "meta", "notifications")
+	}
+
+	list, err := resp.GetObjectArray("query", "notifications", "list")
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid API response: no notifications: %v", resp)
+	}
+	cont, _ = resp.GetString("query", "notifications", "continue")
+
+	if len(types) == 0 {
+		return list, cont, nil
+	}
+	for _, n := range list {
+		typ, _ := n.GetString("type")
+		for _, t := range types {
+			if typ == t {
+				notifications = append(notifications, n)
+				break
+			}
+		}
+	}
+	return notifications, cont, nil
+}
+
+// MarkNotificationsRead marks the Echo notifications with the IDs ids as read
+// (action=echomarkread).
+// MarkNotificationsRead requires the Echo extension.
+func (w *Client) MarkNotificationsRead(ids []int) error {
+	if len(ids) == 0 {
+		return ErrNoArgs
+	}
+
+	p := params.Values{"action": "echomarkread"}
+	p.AddRange("list", itoaSlice(ids)...)
+	return w.markNotificationsRead(p)
+}
+
+// MarkAllNotificationsRead marks all Echo notifications of the logged-in user
+// in the sections sections ("alert" or "message") as read
+// (action=echomarkread). If no sections are given, all notifications are
+// marked as read.
+// MarkAllNotificationsRead requires the Echo extension.
+func (w *Client) MarkAllNotificationsRead(sections ...string) error {
+	p := params.Values{"action": "echomarkread"}
+	if len(sections) > 0 {
+		p.AddRange("sections", sections...)
+	} else {
+		p.Set("all", "")
+	}
+	return w.markNotificationsRead(p)
+}
+
+// markNotificationsRead POSTs the action=echomarkread request p and checks
+// its result.
+func (w *Client) markNotificationsRead(p params.Values) error {
+	resp, err := w.postWithToken(CSRFToken, p)
+	if err != nil {
+		return checkModule(err, "action", "echomarkread")
+	}
+	if w.DryRun {
+		return nil
+	}
+
+	result, err := resp.GetString("query", "echomarkread", "result")
+	if err != nil {
+		result, err = resp.GetString("echomarkread", "result")
+	}
+	if err != nil || result != "success" {
+		v, _ := resp.GetValue("query")
+		return fmt.Errorf("unrecognized response: %v", v)
+	}
+	return nil
+}
+
+// AbuseLogEntry is an entry of the AbuseFilter log, recording an action that
+// matched a filter, as returned by list=abuselog.
+type AbuseLogEntry struct {
+	ID int
+	// FilterID is the ID of the filter. Global filters have IDs such as
+	// "global-3".
+	FilterID string
+	// Filter is the public description of the filter.
+	Filter string
+	User   string
+	NS     int
+	Title  string
+	// Action is the action that matched the filter, e.g. "edit".
+	Action string
+	// Result is what the filter did, e.g. "disallow" or "warn", or empty if
+	// it only logged the action.
+	Result    string
+	Timestamp string
+	// RevID is the ID of the revision created by the action, if it was
+	// not prevented.
+	RevID int
+}
+
+// AbuseLog calls f with each entry of the AbuseFilter log (list=abuselog),
+// newest first. p may contain any list=abuselog parameters, e.g. "aflfilter",
+// "afluser", or "aflstart" and "aflend" to limit the time range.
+// If f returns an error, no further requests are made and AbuseLog returns
+// the error. If the user is not allowed to view the log, a PermissionError is
+// returned.
+// AbuseLog requires the AbuseFilter extension.
+func (w *Client) AbuseLog(p params.Values, f func(entry AbuseLogEntry) error) error {
+	q := params.Values{
+		"list":     "abuselog",
+		"aflprop":  "ids|filter|user|title|action|result|timestamp|revid",
+		"afllimit": "max",
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("list", "abuselog")
+
+	err := w.queryEach(q, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				AbuseLog []struct {
+					ID        int             `json:"id"`
+					FilterID  json.RawMessage `json:"filter_id"`
+					Filter    string          `json:"filter"`
+					User      string          `json:"user"`
+					NS        int             `json:"ns"`
+					Title     string          `json:"title"`
+					Action    string          `json:"action"`
+					Result    string          `json:"result"`
+					Timestamp string          `json:"timestamp"`
+					RevID     json.RawMessage `json:"revid"`
+				} `json:"abuselog"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+
+		for _, e := range r.Query.AbuseLog {
+			// The filter ID and revision ID are strings in some versions of
+			// AbuseFilter, and the revision ID is an empty string if there
+			// is no revision.
+			entry := AbuseLogEntry{
+				ID:        e.ID,
+				FilterID:  strings.Trim(string(e.FilterID), `"`),
+				Filter:    e.Filter,
+				User:      e.User,
+				NS:        e.NS,
+				Title:     e.Title,
+				Action:    e.Action,
+				Result:    e.Result,
+				Timestamp: e.Timestamp,
+			}
+			entry.RevID, _ = strconv.Atoi(strings.Trim(string(e.RevID), `"`))
+			if err := f(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return checkModule(err, "list", "abuselog")
+}
@@ -0,0 +1,362 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestGlobalUsage(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "globalusage" {
+			t.Fatalf("prop != globalusage: prop=%s", v)
+		}
+
+		if reqCount == 0 {
+			fmt.Fprint(w, `{"continue":{"gucontinue":"x","continue":"||"},"query":{"pages":[
+			{"title":"File:Example.jpg","globalusage":[{"title":"Foo","wiki":"en.wikipedia.org","url":"https://en.wikipedia.org/wiki/Foo"}]}]}}`)
+		} else {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"title":"File:Example.jpg","globalusage":[{"title":"Bar","wiki":"de.wikipedia.org","url":"https://de.wikipedia.org/wiki/Bar"}]}]}}`)
+		}
+		reqCount++
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	uses, err := client.GlobalUsage("File:Example.jpg")
+	if err != nil {
+		t.Fatalf("GlobalUsage returned error: %v", err)
+	}
+	if len(uses) != 2 {
+		t.Fatalf("expected 2 uses, got %d: %v", len(uses), uses)
+	}
+	if uses[1].Wiki != "de.wikipedia.org" || uses[1].Title != "Bar" {
+		t.Errorf("unexpected second use: %+v", uses[1])
+	}
+}
+
+func TestGlobalUsageNotInstalled(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"batchcomplete":true,"warnings":{"query":{"warnings":"Unrecognized value for parameter \"prop\": globalusage."}},"query":{"pages":[{"title":"File:Example.jpg"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	_, err := client.GlobalUsage("File:Example.jpg")
+	if _, ok := err.(UnknownModuleError); !ok {
+		t.Fatalf("expected UnknownModuleError, got %#v", err)
+	}
+}
+
+func TestCirrusDocMissing(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"Nope","missing":true}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if _, err := client.CirrusDoc("Nope"); err != ErrPageNotFound {
+		t.Fatalf("expected ErrPageNotFound, got %v", err)
+	}
+}
+
+func TestShortDescription(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "description" {
+			t.Fatalf("prop != description: prop=%s", v)
+		}
+
+		if r.Form.Get("titles") == "Plain" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":2,"ns":0,"title":"Plain"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"Douglas Adams",
+		"description":"English writer and humorist","descriptionsource":"local"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	desc, source, err := client.ShortDescription("Douglas Adams")
+	if err != nil {
+		t.Fatalf("ShortDescription returned error: %v", err)
+	}
+	if desc != "English writer and humorist" || source != "local" {
+		t.Fatalf("unexpected description: desc=%s, source=%s", desc, source)
+	}
+
+	desc, source, err = client.ShortDescription("Plain")
+	if err != nil || desc != "" || source != "" {
+		t.Fatalf("expected no description, got desc=%s, source=%s, err=%v", desc, source, err)
+	}
+}
+
+func TestEntityUsage(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,
+		"title":"Douglas Adams","wbentityusage":{"Q42":{"aspects":["S","T","L.en"]},
+		"Q5":{"aspects":["L.en"]}}}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	usage, err := client.EntityUsage("Douglas Adams")
+	if err != nil {
+		t.Fatalf("EntityUsage returned error: %v", err)
+	}
+	if len(usage) != 2 || len(usage["Q42"]) != 3 || usage["Q5"][0] != "L.en" {
+		t.Errorf("unexpected usage: %v", usage)
+	}
+}
+
+func TestCheckSpamBlacklist(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "spamblacklist" {
+			t.Fatalf("action != spamblacklist: action=%s", v)
+		}
+		if v := r.Form.Get("url"); v != "http://example.com/|http://spam.example.org/page" {
+			t.Fatalf("unexpected url parameter: url=%s", v)
+		}
+
+		fmt.Fprint(w, `{"spamblacklist":{"result":"blacklisted","matches":["http://spam.example.org/"]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	results, err := client.CheckSpamBlacklist([]string{"http://example.com/", "http://spam.example.org/page"})
+	if err != nil {
+		t.Fatalf("CheckSpamBlacklist returned error: %v", err)
+	}
+	if results["http://example.com/"] {
+		t.Errorf("http://example.com/ reported as blacklisted")
+	}
+	if !results["http://spam.example.org/page"] {
+		t.Errorf("http://spam.example.org/page not reported as blacklisted")
+	}
+}
+
+func TestActiveCampaigns(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "centralnoticeactivecampaigns" {
+			t.Fatalf("list != centralnoticeactivecampaigns: list=%s", v)
+		}
+		if _, ok := r.Form["cnacincludefuture"]; !ok {
+			t.Fatalf("cnacincludefuture not set")
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"centralnoticeactivecampaigns":{"campaigns":[
+		{"name":"Fundraising","start":"20261101000000","end":"20261201000000","banners":["FR_Banner1","FR_Banner2"],"countries":["US"]}]}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	campaigns, err := client.ActiveCampaigns(true)
+	if err != nil {
+		t.Fatalf("ActiveCampaigns returned error: %v", err)
+	}
+	if len(campaigns) != 1 {
+		t.Fatalf("expected 1 campaign, got %d: %v", len(campaigns), campaigns)
+	}
+	if c := campaigns[0]; c.Name != "Fundraising" || len(c.Banners) != 2 || c.Start != "20261101000000" {
+		t.Fatalf("unexpected campaign: %#v", c)
+	}
+}
+
+func TestBannerChoicesUnknownModule(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"badvalue","info":"Unrecognized value for parameter \"action\": centralnoticechoicedata."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	_, err := client.BannerChoices("wikipedia", "en")
+	if _, ok := err.(UnknownModuleError); !ok {
+		t.Fatalf("expected UnknownModuleError, got %#v", err)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("meta"); v != "notifications" {
+			t.Fatalf("meta != notifications: meta=%s", v)
+		}
+		if v := r.Form.Get("notfilter"); v != "!read" {
+			t.Fatalf("notfilter != !read: notfilter=%s", v)
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"notifications":{"list":[
+		{"wiki":"testwiki","id":3,"type":"mention","category":"mention","title":{"full":"Talk:Foo"}},
+		{"wiki":"testwiki","id":2,"type":"edit-user-talk","category":"edit-user-talk","title":{"full":"User talk:Bot"}},
+		{"wiki":"testwiki","id":1,"type":"thank-you-edit","category":"thank-you-edit"}],
+		"continue":"1|1"}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	notifications, cont, err := client.Notifications(params.Values{"notfilter": "!read"})
+	if err != nil {
+		t.Fatalf("Notifications returned error: %v", err)
+	}
+	if len(notifications) != 3 || cont != "1|1" {
+		t.Fatalf("expected 3 notifications and continuation 1|1, got %d and %s", len(notifications), cont)
+	}
+
+	notifications, _, err = client.Notifications(params.Values{"notfilter": "!read"}, "mention", "edit-user-talk")
+	if err != nil {
+		t.Fatalf("Notifications returned error: %v", err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(notifications))
+	}
+	if id, _ := notifications[0].GetInt64("id"); id != 3 {
+		t.Fatalf("id != 3: id=%d", id)
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.PostForm.Get("action"); v != "echomarkread" {
+			t.Fatalf("action != echomarkread: action=%s", v)
+		}
+		if r.PostForm.Get("token") != "CSRFTOKEN" {
+			t.Fatalf("token not sent: %v", r.PostForm)
+		}
+		switch {
+		case r.PostForm.Get("list") == "3|4":
+		case r.PostForm.Get("sections") == "message":
+		default:
+			if _, ok := r.PostForm["all"]; !ok {
+				t.Fatalf("unexpected parameters: %v", r.PostForm)
+			}
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"echomarkread":{"result":"success",
+		"count":"0","rawcount":0}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "CSRFTOKEN"
+	if err := client.MarkNotificationsRead([]int{3, 4}); err != nil {
+		t.Fatalf("MarkNotificationsRead returned error: %v", err)
+	}
+	if err := client.MarkAllNotificationsRead("message"); err != nil {
+		t.Fatalf("MarkAllNotificationsRead returned error: %v", err)
+	}
+	if err := client.MarkAllNotificationsRead(); err != nil {
+		t.Fatalf("MarkAllNotificationsRead returned error: %v", err)
+	}
+}
+
+func TestMarkNotificationsReadNoEcho(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"badvalue",
+		"info":"Unrecognized value for parameter \"action\": echomarkread."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "CSRFTOKEN"
+	err := client.MarkNotificationsRead([]int{1})
+	if _, ok := err.(UnknownModuleError); !ok {
+		t.Fatalf("expected UnknownModuleError, got %T: %v", err, err)
+	}
+}
+
+func TestAbuseLog(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "abuselog" {
+			t.Fatalf("list != abuselog: list=%s", v)
+		}
+		if r.Form.Get("aflfilter") == "secret" {
+			fmt.Fprint(w, `{"error":{"code":"permissiondenied",
+			"info":"You don't have permission to view the abuse log details."}}`)
+			return
+		}
+		if r.Form.Get("aflstart") == "" {
+			fmt.Fprint(w, `{"continue":{"aflstart":"2026-01-01T00:00:00Z","continue":"-||"},
+			"query":{"abuselog":[{"id":2,"filter_id":"4","filter":"Page blanking","user":"Vandal",
+			"ns":0,"title":"Foo","action":"edit","result":"disallow","timestamp":"2026-01-02T00:00:00Z",
+			"revid":""}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"abuselog":[{"id":1,"filter_id":"global-3",
+		"filter":"Link spam","user":"Spammer","ns":0,"title":"Bar","action":"edit","result":"",
+		"timestamp":"2026-01-01T00:00:00Z","revid":123}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var entries []AbuseLogEntry
+	err := client.AbuseLog(nil, func(entry AbuseLogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AbuseLog returned error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if e := entries[0]; e.FilterID != "4" || e.Result != "disallow" || e.RevID != 0 || e.User != "Vandal" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e := entries[1]; e.FilterID != "global-3" || e.RevID != 123 || e.Title != "Bar" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+
+	err = client.AbuseLog(params.Values{"aflfilter": "secret"}, func(entry AbuseLogEntry) error {
+		return nil
+	})
+	if _, ok := err.(PermissionError); !ok {
+		t.Fatalf("expected PermissionError, got %#v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package mwclient
+
+import (
+	"fmt"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// LockGlobalAccount locks the global (CentralAuth) account of user, giving
+// reason as the reason for the lock. The client must be logged in as a user
+// with the setglobalaccountstatus right (i.e., a steward).
+// See https://www.mediawiki.org/wiki/Extension:CentralAuth/API
+func (w *Client) LockGlobalAccount(user, reason string) error {
+	return w.setGlobalAccountStatus(user, "lock", reason)
+}
+
+// UnlockGlobalAccount unlocks the global (CentralAuth) account of user.
+// See LockGlobalAccount.
+func (w *Client) UnlockGlobalAccount(user, reason string) error {
+	return w.setGlobalAccountStatus(user, "unlock", reason)
+}
+
+func (w *Client) setGlobalAccountStatus(user, locked, reason string) error {
+	p := params.Values{
+		"action": "setglobalaccountstatus",
+		"user":   user,
+		"locked": locked,
+		"reason": reason,
+	}
+
+	resp, err := w.postWithToken(SetGlobalAccountStatusToken, p)
+	if err != nil || w.DryRun {
+		return err
+	}
+
+	// The response echoes the new status, i.e. "locked" or "unlocked".
+	status, err := resp.GetString("setglobalaccountstatus", "locked")
+	if err != nil {
+		status, _ := resp.GetValue("setglobalaccountstatus")
+		return fmt.Errorf("unrecognized response: %v", status)
+	}
+	if status != locked+"ed" {
+		return fmt.Errorf("global account status of %s not changed: %s", user, status)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestLockGlobalAccount(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "setglobalaccountstatus" {
+			t.Fatalf("action != setglobalaccountstatus: action=%s", v)
+		}
+		if v := r.Form.Get("token"); v != "STEWARDTOKEN" {
+			t.Fatalf("token != STEWARDTOKEN: token=%s", v)
+		}
+		if v := r.Form.Get("locked"); v != "lock" {
+			t.Fatalf("locked != lock: locked=%s", v)
+		}
+
+		fmt.Fprint(w, `{"setglobalaccountstatus":{"user":"Vandal","locked":"locked"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[SetGlobalAccountStatusToken] = "STEWARDTOKEN"
+	if err := client.LockGlobalAccount("Vandal", "spam"); err != nil {
+		t.Fatalf("LockGlobalAccount returned error: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/url"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// Revision is a revision of a page, as returned by PageHistory.
+type Revision struct {
+	RevID     int    `json:"revid"`
+	ParentID  int    `json:"parentid"`
+	User      string `json:"user"`
+	Timestamp string `json:"timestamp"`
+	Comment   string `json:"comment"`
+	Size      int    `json:"size"`
+	Minor     bool   `json:"minor"`
+}
+
+// PageHistory scans the revisions of the page title, from the newest to the
+// oldest, and calls f with each batch of revisions returned by the API.
+// If f returns false, the scan is paused and PageHistory returns a checkpoint
+// that can be passed to a later call of PageHistory to resume the scan with
+// the next batch. To start a scan from the newest revision, pass an empty
+// checkpoint. When the scan is complete, the returned checkpoint is empty.
+//
+// The checkpoint is an opaque string containing the continuation parameters
+// returned by the API. Do not depend on its format, which may change
+// between versions of MediaWiki and of this package.
+//
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) PageHistory(title, checkpoint string, f func(revs []Revision) bool) (string, error) {
+	p := params.Values{
+		"prop":    "revisions",
+		"titles":  title,
+		"rvprop":  "ids|timestamp|user|comment|size|flags",
+		"rvlimit": "max",
+	}
+	q := w.NewQuery(p)
+	if checkpoint != "" {
+		cont, err := url.ParseQuery(checkpoint)
+		if err != nil {
+			return "", fmt.Errorf("invalid checkpoint: %v", err)
+		}
+		for k := range cont {
+			p.Set(k, cont.Get(k))
+		}
+	}
+
+	for q.Next() {
+		var r struct {
+			Continue map[string]interface{} `json:"continue"`
+			Query    struct {
+				Pages []struct {
+					Missing   bool       `json:"missing"`
+					Revisions []Revision `json:"revisions"`
+				} `json:"pages"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(q.Resp(), &r); err != nil {
+			return "", err
+		}
+		if len(r.Query.Pages) == 0 {
+			return "", fmt.Errorf("invalid API response: no pages: %v", q.Resp())
+		}
+		page := r.Query.Pages[0]
+		if page.Missing {
+			return "", ErrPageNotFound
+		}
+
+		if !f(page.Revisions) {
+			cont := url.Values{}
+			for k, v := range r.Continue {
+				cont.Set(k, fmt.Sprint(v))
+			}
+			return cont.Encode(), nil
+		}
+	}
+
+	return "", q.Err()
+}
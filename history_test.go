@@ -0,0 +1,64 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestPageHistoryCheckpoint(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "revisions" {
+			t.Fatalf("prop != revisions: prop=%s", v)
+		}
+
+		if r.Form.Get("rvcontinue") == "" {
+			fmt.Fprint(w, `{"continue":{"rvcontinue":"20260101000000|2","continue":"||"},"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"Foo","revisions":[{"revid":3,"parentid":2,"user":"A","timestamp":"2026-01-02T00:00:00Z","comment":"c","size":3}]}]}}`)
+		} else {
+			if v := r.Form.Get("rvcontinue"); v != "20260101000000|2" {
+				t.Fatalf("rvcontinue != 20260101000000|2: rvcontinue=%s", v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"Foo","revisions":[{"revid":2,"parentid":1,"user":"B","timestamp":"2026-01-01T00:00:00Z","comment":"b","size":2,"minor":true},
+			{"revid":1,"parentid":0,"user":"A","timestamp":"2025-12-31T00:00:00Z","comment":"a","size":1}]}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var revids []int
+	collect := func(pause bool) func([]Revision) bool {
+		return func(revs []Revision) bool {
+			for _, rev := range revs {
+				revids = append(revids, rev.RevID)
+			}
+			return !pause
+		}
+	}
+
+	checkpoint, err := client.PageHistory("Foo", "", collect(true))
+	if err != nil {
+		t.Fatalf("PageHistory returned error: %v", err)
+	}
+	if checkpoint == "" {
+		t.Fatal("PageHistory did not return a checkpoint when paused")
+	}
+
+	checkpoint, err = client.PageHistory("Foo", checkpoint, collect(false))
+	if err != nil {
+		t.Fatalf("PageHistory returned error: %v", err)
+	}
+	if checkpoint != "" {
+		t.Fatalf("PageHistory returned a checkpoint after completing: %s", checkpoint)
+	}
+	if fmt.Sprint(revids) != "[3 2 1]" {
+		t.Fatalf("revids != [3 2 1]: revids=%v", revids)
+	}
+}
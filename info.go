@@ -0,0 +1,547 @@
+package mwclient
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// pageInfo is a page object as returned by prop=info.
+// Only the fields used by the helper methods in this package are included.
+type pageInfo struct {
+	PageID  int    `json:"pageid"`
+	NS      int    `json:"ns"`
+	Title   string `json:"title"`
+	Missing bool   `json:"missing"`
+	Invalid bool   `json:"invalid"`
+	// LastRevID is the ID of the latest revision of the page.
+	LastRevID int `json:"lastrevid"`
+
+	// inprop=watched
+	Watched         bool   `json:"watched"`
+	WatchlistExpiry string `json:"watchlistexpiry"`
+
+	// inprop=displaytitle
+	DisplayTitle string `json:"displaytitle"`
+
+	// inprop=varianttitles
+	VariantTitles map[string]string `json:"varianttitles"`
+
+	// inprop=associatedpage
+	AssociatedPage string `json:"associatedpage"`
+
+	// inprop=notificationtimestamp
+	NotificationTimestamp string `json:"notificationtimestamp"`
+
+	// inprop=watchers. Nil if the count is hidden from the user.
+	Watchers *int `json:"watchers"`
+
+	// inprop=preloadcontent (MediaWiki 1.41+)
+	PreloadContent struct {
+		Content string `json:"content"`
+	} `json:"preloadcontent"`
+	// inprop=preload (before MediaWiki 1.41)
+	Preload string `json:"preload"`
+}
+
+type pageInfoResponse struct {
+	Query struct {
+		Pages []pageInfo `json:"pages"`
+	} `json:"query"`
+}
+
+// getPageInfo gets prop=info information about the page title.
+// The values of inprop are sent as the inprop parameter.
+// As with Get, API warnings are returned as the error value, but unlike Get,
+// the page information is returned along with the warnings.
+func (w *Client) getPageInfo(title string, inprop ...string) (pageInfo, error) {
+	return w.getPageInfoWithOptions(title, callOptions{}, inprop...)
+}
+
+// getPageInfoWithOptions is like getPageInfo, but takes a callOptions.
+func (w *Client) getPageInfoWithOptions(title string, opts callOptions, inprop ...string) (pageInfo, error) {
+	p := params.Values{
+		"action": "query",
+		"prop":   "info",
+		"titles": title,
+	}
+	if len(inprop) > 0 {
+		p.AddRange("inprop", inprop...)
+	}
+
+	resp, err := w.callJSONWithOptions(p, opts)
+	if resp == nil {
+		return pageInfo{}, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return pageInfo{}, err
+	}
+	warnings := err
+
+	var r pageInfoResponse
+	if err := unmarshalObject(resp, &r); err != nil {
+		return pageInfo{}, err
+	}
+	if len(r.Query.Pages) == 0 {
+		return pageInfo{}, fmt.Errorf("invalid API response: no page information: %v", resp)
+	}
+	page := r.Query.Pages[0]
+	if page.Invalid {
+		return page, errors.New("invalid page title: " + title)
+	}
+
+	return page, warnings
+}
+
+// DisplayTitle returns the title of the page title as it is displayed on the
+// page, which may differ from the page title if it is changed with the
+// DISPLAYTITLE magic word. The display title may contain HTML formatting
+// (e.g., "<i>Title</i>"). If the page does not have a display title,
+// the page title is returned.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) DisplayTitle(title string) (string, error) {
+	page, err := w.getPageInfo(title, "displaytitle")
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return "", err
+	}
+	if page.Missing {
+		return "", ErrPageNotFound
+	}
+	if page.DisplayTitle == "" {
+		return page.Title, err
+	}
+	return page.DisplayTitle, err
+}
+
+// FormattedTitle returns the title of the page title as plain text, formatted
+// as it is displayed on the page. This is the display title (see DisplayTitle)
+// without HTML formatting, so e.g. a lowercase first letter or a different
+// namespace prefix set by the DISPLAYTITLE magic word is kept, but italics are
+// not. If the page does not have a display title, the page title is returned.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) FormattedTitle(title string) (string, error) {
+	displayTitle, err := w.DisplayTitle(title)
+	if displayTitle == "" {
+		return "", err
+	}
+	return stripTags(displayTitle), err
+}
+
+// VariantTitles returns the title of the page title in each language variant
+// of the wiki's content language (inprop=varianttitles), as a map of variant
+// codes (e.g., "zh-hans") to titles. If the content language of the wiki
+// does not have variants, an empty map is returned.
+func (w *Client) VariantTitles(title string) (map[string]string, error) {
+	page, err := w.getPageInfo(title, "varianttitles")
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return nil, err
+	}
+	if page.VariantTitles == nil {
+		return map[string]string{}, err
+	}
+	return page.VariantTitles, err
+}
+
+// LatestRevID returns the ID of the latest revision of the page title
+// (lastrevid in prop=info). This is the cheapest way to check whether a page
+// has changed, as no content is fetched.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) LatestRevID(title string) (int, error) {
+	page, err := w.getPageInfo(title)
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return 0, err
+	}
+	if page.Missing || page.Invalid || page.LastRevID == 0 {
+		return 0, ErrPageNotFound
+	}
+	return page.LastRevID, err
+}
+
+// RedirectTarget reports whether the page title is a redirect, and if so,
+// returns the page it redirects to. Unlike the redirects parameter of the
+// API, which resolves chains of redirects, RedirectTarget returns the direct
+// target of the redirect, which may itself be a redirect. If the redirect
+// points to a section, the target includes the section (e.g., "Foo#Bar").
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) RedirectTarget(title string) (target string, isRedirect bool, err error) {
+	p := params.Values{
+		"action":    "query",
+		"prop":      "info",
+		"titles":    title,
+		"redirects": "",
+	}
+
+	resp, err := w.Get(p)
+	if resp == nil {
+		return "", false, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return "", false, err
+	}
+	warnings := err
+
+	var r struct {
+		Query struct {
+			Normalized []struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			} `json:"normalized"`
+			Redirects []struct {
+				From       string `json:"from"`
+				To         string `json:"to"`
+				ToFragment string `json:"tofragment"`
+			} `json:"redirects"`
+			Pages []pageInfo `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return "", false, err
+	}
+
+	for _, norm := range r.Query.Normalized {
+		if norm.From == title {
+			title = norm.To
+		}
+	}
+	for _, redirect := range r.Query.Redirects {
+		if redirect.From == title {
+			target = redirect.To
+			if redirect.ToFragment != "" {
+				target += "#" + redirect.ToFragment
+			}
+			return target, true, warnings
+		}
+	}
+
+	if len(r.Query.Pages) == 0 {
+		return "", false, fmt.Errorf("invalid API response: no page information: %v", resp)
+	}
+	if page := r.Query.Pages[0]; page.Invalid {
+		return "", false, errors.New("invalid page title: " + title)
+	} else if page.Missing {
+		return "", false, ErrPageNotFound
+	}
+	return "", false, warnings
+}
+
+// AssociatedPage returns the title of the talk page of the page title if it is
+// a subject page, or the title of the subject page if it is a talk page
+// (inprop=associatedpage). The page does not have to exist.
+func (w *Client) AssociatedPage(title string) (string, error) {
+	page, err := w.getPageInfo(title, "associatedpage")
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return "", err
+	}
+	if page.AssociatedPage == "" {
+		// Pages in virtual namespaces (Special and Media)
+		// do not have associated pages.
+		return "", fmt.Errorf("page %s does not have an associated page", title)
+	}
+	return page.AssociatedPage, err
+}
+
+// NotificationTimestamp returns the time of the first change to the page
+// title since the logged-in user last visited it, if the page is on the
+// user's watchlist (inprop=notificationtimestamp). The zero time is returned
+// if the page has no unseen changes, is not watched, or the user is not
+// logged in.
+func (w *Client) NotificationTimestamp(title string) (time.Time, error) {
+	page, err := w.getPageInfo(title, "notificationtimestamp")
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return time.Time{}, err
+	}
+	if page.NotificationTimestamp == "" {
+		return time.Time{}, err
+	}
+	ts, perr := time.Parse(time.RFC3339, page.NotificationTimestamp)
+	if perr != nil {
+		return time.Time{}, fmt.Errorf("invalid API response: bad notification timestamp: %s", perr)
+	}
+	return ts, err
+}
+
+// Watchers returns the amount of users watching the page title
+// (inprop=watchers) and whether the logged-in user is one of them
+// (inprop=watched). Unless the user has the unwatchedpages right, the amount
+// of watchers is hidden if it is below a threshold set by the wiki; in that
+// case, -1 is returned as the amount.
+func (w *Client) Watchers(title string) (watchers int, watched bool, err error) {
+	page, err := w.getPageInfo(title, "watchers", "watched")
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return 0, false, err
+	}
+	if page.Watchers == nil {
+		return -1, page.Watched, err
+	}
+	return *page.Watchers, page.Watched, err
+}
+
+// PreloadContent returns the content that the edit form is preloaded with
+// when creating the page title, e.g. a template configured for the page's
+// namespace. An empty string is returned if no preload content is configured.
+// On wikis older than MediaWiki 1.41, the deprecated inprop=preload is used.
+func (w *Client) PreloadContent(title string) (string, error) {
+	page, err := w.getPageInfo(title, "preloadcontent")
+	warnings, ok := err.(APIWarnings)
+	if err != nil && !ok {
+		return "", err
+	}
+	for _, warning := range warnings {
+		if warning.Module == "info" && strings.Contains(warning.Info, "preloadcontent") {
+			page, err = w.getPageInfo(title, "preload")
+			if _, ok := err.(APIWarnings); err != nil && !ok {
+				return "", err
+			}
+			return w.normalizeContent(page.Preload), err
+		}
+	}
+	return w.normalizeContent(page.PreloadContent.Content), err
+}
+
+// resolveRedirectsChunkSize is the maximum amount of titles sent in one
+// request by ResolveRedirects.
+const resolveRedirectsChunkSize = 50
+
+// ResolveRedirects resolves the redirects among titles, in chunks of 50 titles
+// per request, and returns a map of the input titles to the titles they
+// redirect to. Chains of redirects are resolved to their final target.
+// Titles that are not redirects are mapped to their normalized form,
+// e.g. "foo_bar" to "Foo bar".
+func (w *Client) ResolveRedirects(titles []string) (map[string]string, error) {
+	if len(titles) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	resolved := make(map[string]string, len(titles))
+	for _, chunk := range chunk(titles, resolveRedirectsChunkSize) {
+		p := params.Values{
+			"action":    "query",
+			"redirects": "",
+		}
+		p.AddRange("titles", chunk...)
+
+		resp, err := w.Get(p)
+		if resp == nil {
+			return nil, err
+		}
+		if _, ok := err.(APIWarnings); err != nil && !ok {
+			return nil, err
+		}
+
+		var r struct {
+			Query struct {
+				Normalized []struct {
+					From string `json:"from"`
+					To   string `json:"to"`
+				} `json:"normalized"`
+				Redirects []struct {
+					From string `json:"from"`
+					To   string `json:"to"`
+				} `json:"redirects"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return nil, err
+		}
+
+		normalized := make(map[string]string, len(r.Query.Normalized))
+		for _, norm := range r.Query.Normalized {
+			normalized[norm.From] = norm.To
+		}
+		redirects := make(map[string]string, len(r.Query.Redirects))
+		for _, redirect := range r.Query.Redirects {
+			redirects[redirect.From] = redirect.To
+		}
+
+		for _, title := range chunk {
+			target := title
+			if norm, ok := normalized[target]; ok {
+				target = norm
+			}
+			// Follow chains of redirects, guarding against loops.
+			for i := 0; i <= len(redirects); i++ {
+				to, ok := redirects[target]
+				if !ok {
+					break
+				}
+				target = to
+			}
+			resolved[title] = target
+		}
+	}
+
+	return resolved, nil
+}
+
+// pagesExistChunkSize is the maximum amount of titles sent in one request by
+// PagesExist.
+const pagesExistChunkSize = 50
+
+// PagesExist reports which of titles exist, in chunks of 50 titles per
+// request. The returned map is keyed by the titles as passed, even if the API
+// normalized them (e.g., "foo_bar" to "Foo bar"). Invalid titles are reported
+// as not existing.
+func (w *Client) PagesExist(titles []string) (map[string]bool, error) {
+	if len(titles) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	exist := make(map[string]bool, len(titles))
+	for _, chunk := range chunk(titles, pagesExistChunkSize) {
+		p := params.Values{
+			"action": "query",
+		}
+		p.AddRange("titles", chunk...)
+
+		resp, err := w.Get(p)
+		if resp == nil {
+			return nil, err
+		}
+		if _, ok := err.(APIWarnings); err != nil && !ok {
+			return nil, err
+		}
+
+		var r struct {
+			Query struct {
+				Normalized []struct {
+					From string `json:"from"`
+					To   string `json:"to"`
+				} `json:"normalized"`
+				Pages []pageInfo `json:"pages"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return nil, err
+		}
+
+		normalized := make(map[string]string, len(r.Query.Normalized))
+		for _, norm := range r.Query.Normalized {
+			normalized[norm.From] = norm.To
+		}
+		pages := make(map[string]bool, len(r.Query.Pages))
+		for _, page := range r.Query.Pages {
+			pages[page.Title] = !page.Missing && !page.Invalid
+		}
+
+		for _, title := range chunk {
+			if norm, ok := normalized[title]; ok {
+				exist[title] = pages[norm]
+			} else {
+				exist[title] = pages[title]
+			}
+		}
+	}
+
+	return exist, nil
+}
+
+// verifyEditRetries is the amount of times VerifyEdit reads the page again
+// if the revision is not visible yet.
+const verifyEditRetries = 3
+
+// VerifyEdit reports whether the revision revid (e.g., the revision created by
+// an edit) is visible as the latest revision of the page title, or if the page
+// has been edited again since, as an earlier revision. If the revision is not
+// visible, e.g. because the API is served by a lagging database replica,
+// VerifyEdit reads the page again up to three times, waiting as specified by
+// the client's backoff strategy (see SetBackoff), before returning false.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) VerifyEdit(title string, revid int) (bool, error) {
+	for try := 0; ; try++ {
+		page, err := w.getPageInfoWithOptions(title, callOptions{fresh: true})
+		if _, ok := err.(APIWarnings); err != nil && !ok {
+			return false, err
+		}
+		if page.Missing && try == verifyEditRetries {
+			return false, ErrPageNotFound
+		}
+		if page.LastRevID >= revid {
+			return true, nil
+		}
+		if try == verifyEditRetries {
+			return false, nil
+		}
+		w.sleep(context.Background(), w.retryDelay(try+1))
+	}
+}
+
+// contentSHA1 returns the SHA-1 hash (in hexadecimal) of content as
+// MediaWiki would store it: with Windows line endings converted to Unix ones
+// and trailing whitespace removed, as MediaWiki does before saving wikitext.
+func contentSHA1(content string) string {
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	content = strings.TrimRight(content, " \t\n\r\x00\x0b")
+	return fmt.Sprintf("%x", sha1.Sum([]byte(content)))
+}
+
+// VerifyContentSHA1 reports whether localContent is identical to the content
+// of the latest revision of the page title, by comparing its SHA-1 hash
+// with the hash of the revision content returned by the API (which is also
+// returned). localContent is normalized as MediaWiki normalizes wikitext when
+// saving it, so it matches if saving it would not change the page.
+// If the page does not exist, ErrPageNotFound is returned.
+func (w *Client) VerifyContentSHA1(title, localContent string) (match bool, serverSHA1 string, err error) {
+	p := params.Values{
+		"action":  "query",
+		"prop":    "revisions",
+		"titles":  title,
+		"rvprop":  "sha1",
+		"rvslots": "main",
+	}
+
+	resp, err := w.Get(p)
+	if resp == nil {
+		return false, "", err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return false, "", err
+	}
+	warnings := err
+
+	var r struct {
+		Query struct {
+			Pages []struct {
+				Missing   bool `json:"missing"`
+				Invalid   bool `json:"invalid"`
+				Revisions []struct {
+					SHA1  string `json:"sha1"`
+					Slots map[string]struct {
+						SHA1 string `json:"sha1"`
+					} `json:"slots"`
+				} `json:"revisions"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return false, "", err
+	}
+	if len(r.Query.Pages) == 0 {
+		return false, "", fmt.Errorf("invalid API response: no page information: %v", resp)
+	}
+	page := r.Query.Pages[0]
+	if page.Invalid {
+		return false, "", errors.New("invalid page title: " + title)
+	}
+	if page.Missing {
+		return false, "", ErrPageNotFound
+	}
+	if len(page.Revisions) == 0 {
+		return false, "", fmt.Errorf("invalid API response: no revisions: %v", resp)
+	}
+
+	rev := page.Revisions[0]
+	serverSHA1 = rev.SHA1
+	if main, ok := rev.Slots["main"]; ok && main.SHA1 != "" {
+		serverSHA1 = main.SHA1
+	}
+	if serverSHA1 == "" {
+		// The content of the revision has been deleted.
+		return false, "", fmt.Errorf("content of the latest revision of %s is hidden", title)
+	}
+	return contentSHA1(localContent) == serverSHA1, serverSHA1, warnings
+}
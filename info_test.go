@@ -0,0 +1,487 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisplayTitle(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("inprop"); v != "displaytitle" {
+			t.Fatalf("inprop != displaytitle: inprop=%s", v)
+		}
+
+		switch r.Form.Get("titles") {
+		case "IPhone":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"IPhone","displaytitle":"<span>iPhone</span>"}]}}`)
+		case "Plain":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":2,"ns":0,"title":"Plain"}]}}`)
+		default:
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"ns":0,"title":"Missing","missing":true}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if dt, err := client.DisplayTitle("IPhone"); err != nil {
+		t.Fatalf("DisplayTitle returned error: %v", err)
+	} else if dt != "<span>iPhone</span>" {
+		t.Fatalf("dt != <span>iPhone</span>: dt=%s", dt)
+	}
+	if dt, err := client.DisplayTitle("Plain"); err != nil {
+		t.Fatalf("DisplayTitle returned error: %v", err)
+	} else if dt != "Plain" {
+		t.Fatalf("dt != Plain: dt=%s", dt)
+	}
+	if _, err := client.DisplayTitle("Missing"); err != ErrPageNotFound {
+		t.Fatalf("expected ErrPageNotFound, got %v", err)
+	}
+}
+
+func TestFormattedTitle(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":1,"ns":1,"title":"Talk:Foo & bar","displaytitle":"<span class=\"mw-page-title-namespace\">Talk</span>:<i>Foo &amp; bar</i>"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	title, err := client.FormattedTitle("Talk:Foo & bar")
+	if err != nil {
+		t.Fatalf("FormattedTitle returned error: %v", err)
+	}
+	if title != "Talk:Foo & bar" {
+		t.Fatalf("title != Talk:Foo & bar: title=%s", title)
+	}
+}
+
+func TestVariantTitles(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("inprop"); v != "varianttitles" {
+			t.Fatalf("inprop != varianttitles: inprop=%s", v)
+		}
+
+		if r.Form.Get("titles") == "Plain" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":2,"ns":0,"title":"Plain"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"中国",
+		"varianttitles":{"zh":"中国","zh-hans":"中国","zh-hant":"中國"}}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	variants, err := client.VariantTitles("中国")
+	if err != nil {
+		t.Fatalf("VariantTitles returned error: %v", err)
+	}
+	if v := variants["zh-hant"]; v != "中國" {
+		t.Fatalf("variants[zh-hant] != 中國: variants[zh-hant]=%s", v)
+	}
+
+	variants, err = client.VariantTitles("Plain")
+	if err != nil {
+		t.Fatalf("VariantTitles returned error: %v", err)
+	}
+	if variants == nil || len(variants) != 0 {
+		t.Fatalf("expected empty map, got %#v", variants)
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("titles") {
+		case "double_redirect":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{
+			"normalized":[{"fromencoded":false,"from":"double_redirect","to":"Double redirect"}],
+			"redirects":[{"from":"Double redirect","to":"Redirect","tofragment":"Section"},{"from":"Redirect","to":"Target"}],
+			"pages":[{"pageid":3,"ns":0,"title":"Target"}]}}`)
+		case "Target":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":3,"ns":0,"title":"Target"}]}}`)
+		default:
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"Missing","missing":true}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	target, isRedirect, err := client.RedirectTarget("double_redirect")
+	if err != nil {
+		t.Fatalf("RedirectTarget returned error: %v", err)
+	}
+	if !isRedirect || target != "Redirect#Section" {
+		t.Fatalf("unexpected redirect target: target=%s isRedirect=%t", target, isRedirect)
+	}
+
+	target, isRedirect, err = client.RedirectTarget("Target")
+	if err != nil || isRedirect || target != "" {
+		t.Fatalf("non-redirect reported as redirect: target=%s isRedirect=%t err=%v", target, isRedirect, err)
+	}
+
+	if _, _, err := client.RedirectTarget("Missing"); err != ErrPageNotFound {
+		t.Fatalf("expected ErrPageNotFound, got %v", err)
+	}
+}
+
+func TestAssociatedPage(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("inprop"); v != "associatedpage" {
+			t.Fatalf("inprop != associatedpage: inprop=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":1,"ns":4,"title":"Wikipedia:Foo","associatedpage":"Wikipedia talk:Foo"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	talk, err := client.AssociatedPage("Wikipedia:Foo")
+	if err != nil {
+		t.Fatalf("AssociatedPage returned error: %v", err)
+	}
+	if talk != "Wikipedia talk:Foo" {
+		t.Fatalf("talk != Wikipedia talk:Foo: talk=%s", talk)
+	}
+}
+
+func TestNotificationTimestamp(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("inprop"); v != "notificationtimestamp" {
+			t.Fatalf("inprop != notificationtimestamp: inprop=%s", v)
+		}
+
+		if r.Form.Get("titles") == "Changed" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"Changed","notificationtimestamp":"2020-01-02T03:04:05Z"}]}}`)
+		} else {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":2,"ns":0,"title":"Seen","notificationtimestamp":""}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	ts, err := client.NotificationTimestamp("Changed")
+	if err != nil {
+		t.Fatalf("NotificationTimestamp returned error: %v", err)
+	}
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !ts.Equal(want) {
+		t.Fatalf("ts != %s: ts=%s", want, ts)
+	}
+
+	ts, err = client.NotificationTimestamp("Seen")
+	if err != nil {
+		t.Fatalf("NotificationTimestamp returned error: %v", err)
+	}
+	if !ts.IsZero() {
+		t.Fatalf("expected zero time, got %s", ts)
+	}
+}
+
+func TestWatchers(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("inprop"); v != "watchers|watched" {
+			t.Fatalf("inprop != watchers|watched: inprop=%s", v)
+		}
+
+		if r.Form.Get("titles") == "Popular" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":1,"ns":0,"title":"Popular","watchers":42,"watched":true}]}}`)
+		} else {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":2,"ns":0,"title":"Obscure","watched":false}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	watchers, watched, err := client.Watchers("Popular")
+	if err != nil {
+		t.Fatalf("Watchers returned error: %v", err)
+	}
+	if watchers != 42 || !watched {
+		t.Fatalf("expected 42 watchers and watched, got %d and %t", watchers, watched)
+	}
+
+	watchers, watched, err = client.Watchers("Obscure")
+	if err != nil {
+		t.Fatalf("Watchers returned error: %v", err)
+	}
+	if watchers != -1 || watched {
+		t.Fatalf("expected -1 watchers and not watched, got %d and %t", watchers, watched)
+	}
+}
+
+func TestPreloadContent(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch r.Form.Get("titles") + " " + r.Form.Get("inprop") {
+		case "Talk:New preloadcontent":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":1,"title":"Talk:New","missing":true,`+
+				`"preloadcontent":{"contentmodel":"wikitext","contentformat":"text/x-wiki","content":"{{Talk header}}"}}]}}`)
+		case "New preloadcontent":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"New","missing":true,`+
+				`"preloadcontent":{"contentmodel":"wikitext","contentformat":"text/x-wiki","content":""}}]}}`)
+		case "Old preloadcontent":
+			fmt.Fprint(w, `{"batchcomplete":true,"warnings":{"info":{"warnings":`+
+				`"Unrecognized value for parameter \"inprop\": preloadcontent."}},`+
+				`"query":{"pages":[{"ns":0,"title":"Old","missing":true}]}}`)
+		case "Old preload":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"Old","missing":true,`+
+				`"preload":"{{Stub}}"}]}}`)
+		default:
+			t.Fatalf("unexpected request: titles=%s, inprop=%s", r.Form.Get("titles"), r.Form.Get("inprop"))
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	for title, want := range map[string]string{
+		"Talk:New": "{{Talk header}}",
+		"New":      "",
+		"Old":      "{{Stub}}",
+	} {
+		content, err := client.PreloadContent(title)
+		if err != nil {
+			t.Fatalf("PreloadContent(%s) returned error: %v", title, err)
+		}
+		if content != want {
+			t.Fatalf("PreloadContent(%s) != %s: content=%s", title, want, content)
+		}
+	}
+}
+
+func TestResolveRedirects(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if _, ok := r.Form["redirects"]; !ok {
+			t.Fatalf("redirects not set")
+		}
+		if v := r.Form.Get("titles"); v != "double_redirect|Redirect|Target" {
+			t.Fatalf("titles != double_redirect|Redirect|Target: titles=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{
+		"normalized":[{"fromencoded":false,"from":"double_redirect","to":"Double redirect"}],
+		"redirects":[{"from":"Double redirect","to":"Redirect"},{"from":"Redirect","to":"Target"}],
+		"pages":[{"pageid":3,"ns":0,"title":"Target"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	resolved, err := client.ResolveRedirects([]string{"double_redirect", "Redirect", "Target"})
+	if err != nil {
+		t.Fatalf("ResolveRedirects returned error: %v", err)
+	}
+	for _, title := range []string{"double_redirect", "Redirect", "Target"} {
+		if resolved[title] != "Target" {
+			t.Errorf("resolved[%s] != Target: resolved[%s]=%s", title, title, resolved[title])
+		}
+	}
+}
+
+func TestLatestRevID(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "info" {
+			t.Fatalf("prop != info: prop=%s", v)
+		}
+		if r.Form.Get("titles") == "Missing" {
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":0,"title":"Missing","missing":true}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":1,"ns":0,"title":"Foo","lastrevid":9007199254740993}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	revid, err := client.LatestRevID("Foo")
+	if err != nil {
+		t.Fatalf("LatestRevID returned error: %v", err)
+	}
+	if revid != 9007199254740993 {
+		t.Fatalf("revid != 9007199254740993: revid=%d", revid)
+	}
+
+	if _, err := client.LatestRevID("Missing"); err != ErrPageNotFound {
+		t.Fatalf("err != ErrPageNotFound: err=%v", err)
+	}
+}
+
+func TestPagesExist(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		reqCount++
+		titles := strings.Split(r.Form.Get("titles"), "|")
+		if reqCount == 1 {
+			if len(titles) != 50 {
+				t.Fatalf("expected 50 titles in the first request, got %d", len(titles))
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{
+			"normalized":[{"fromencoded":false,"from":"main_page","to":"Main page"}],
+			"pages":[{"pageid":1,"ns":0,"title":"Main page"},{"ns":0,"title":"Missing","missing":true}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"title":"Bad[]","invalid":true}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	titles := []string{"main_page", "Missing"}
+	for i := 0; i < 48; i++ {
+		titles = append(titles, "Missing")
+	}
+	titles = append(titles, "Bad[]")
+	exist, err := client.PagesExist(titles)
+	if err != nil {
+		t.Fatalf("PagesExist returned error: %v", err)
+	}
+	if reqCount != 2 {
+		t.Fatalf("reqCount != 2: reqCount=%d", reqCount)
+	}
+	if !exist["main_page"] || exist["Missing"] || exist["Bad[]"] {
+		t.Fatalf("unexpected result: %v", exist)
+	}
+	if _, ok := exist["Main page"]; ok {
+		t.Fatalf("result contains normalized title: %v", exist)
+	}
+}
+
+func TestVerifyEdit(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		lastrevid := 41
+		if reqCount > 1 {
+			lastrevid = 42
+		}
+		fmt.Fprintf(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":1,"ns":0,"title":"Foo","lastrevid":%d}]}}`, lastrevid)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	ok, err := client.VerifyEdit("Foo", 42)
+	if err != nil {
+		t.Fatalf("VerifyEdit returned error: %v", err)
+	}
+	if !ok {
+		t.Fatal("VerifyEdit did not verify edit after stale read")
+	}
+	if reqCount != 2 {
+		t.Fatalf("expected 2 requests, got %d", reqCount)
+	}
+
+	if ok, err := client.VerifyEdit("Foo", 43); err != nil || ok {
+		t.Fatalf("VerifyEdit of invisible revision: ok=%t err=%v", ok, err)
+	}
+}
+
+func TestContentSHA1(t *testing.T) {
+	// SHA-1 of "Hello\nworld".
+	const want = "8b2b2671aca63a28c0f4f92be7030bf9481f113b"
+	for _, content := range []string{"Hello\nworld", "Hello\r\nworld\n\n", "Hello\nworld \t"} {
+		if got := contentSHA1(content); got != want {
+			t.Errorf("contentSHA1(%q) != %s: got %s", content, want, got)
+		}
+	}
+}
+
+func TestVerifyContentSHA1(t *testing.T) {
+	sha := contentSHA1("Text")
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("rvprop"); v != "sha1" {
+			t.Fatalf("rvprop != sha1: rvprop=%s", v)
+		}
+
+		fmt.Fprintf(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"Foo",
+		"revisions":[{"slots":{"main":{"sha1":"%s"}}}]}]}}`, sha)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	match, serverSHA1, err := client.VerifyContentSHA1("Foo", "Text\n")
+	if err != nil {
+		t.Fatalf("VerifyContentSHA1 returned error: %v", err)
+	}
+	if !match || serverSHA1 != sha {
+		t.Fatalf("expected match with %s, got match=%t, serverSHA1=%s", sha, match, serverSHA1)
+	}
+
+	match, _, err = client.VerifyContentSHA1("Foo", "Other text")
+	if err != nil || match {
+		t.Fatalf("expected no match, got match=%t, err=%v", match, err)
+	}
+}
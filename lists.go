@@ -0,0 +1,517 @@
+package mwclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// This file contains typed wrappers for list modules of the query API.
+// They follow query continuations and call a function f with each result, so
+// that large result sets are not held in memory. If f returns an error, no
+// further requests are made and the wrapper returns the error. Use the
+// module's filter parameters in p to reduce the result set.
+
+// Block is an active block, as returned by list=blocks.
+type Block struct {
+	ID        int    `json:"id"`
+	User      string `json:"user"`
+	By        string `json:"by"`
+	Timestamp string `json:"timestamp"`
+	Expiry    string `json:"expiry"`
+	Reason    string `json:"reason"`
+
+	// Block flags.
+	AnonOnly      bool `json:"anononly"`
+	NoCreate      bool `json:"nocreate"`
+	AutoBlock     bool `json:"autoblock"`
+	NoEmail       bool `json:"noemail"`
+	AllowUserTalk bool `json:"allowusertalk"`
+	Hidden        bool `json:"hidden"`
+	Partial       bool `json:"partial"`
+}
+
+// Blocks lists blocks (list=blocks). p may contain any list=blocks
+// parameters, e.g. "bkusers" or "bkshow". If "bkprop" is not set in p,
+// all the properties of Block are requested. f is called with each block.
+// See https://www.mediawiki.org/wiki/API:Blocks
+func (w *Client) Blocks(p params.Values, f func(block Block) error) error {
+	q := params.Values{
+		"bkprop":  "id|user|by|timestamp|expiry|reason|flags",
+		"bklimit": "max",
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("list", "blocks")
+
+	return w.queryEach(q, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				Blocks []Block `json:"blocks"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, block := range r.Query.Blocks {
+			if err := f(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UserDetail is a registered user, as returned by list=allusers.
+type UserDetail struct {
+	ID           int      `json:"userid"`
+	Name         string   `json:"name"`
+	Groups       []string `json:"groups"`
+	EditCount    int      `json:"editcount"`
+	Registration string   `json:"registration"`
+}
+
+// AllUsers lists registered users (list=allusers). p may contain any
+// list=allusers parameters, e.g. "augroup", "aurights", or "auwitheditsonly".
+// If "auprop" is not set in p, all the properties of UserDetail are requested.
+// f is called with each user.
+// See https://www.mediawiki.org/wiki/API:Allusers
+func (w *Client) AllUsers(p params.Values, f func(user UserDetail) error) error {
+	q := params.Values{
+		"auprop":  "groups|editcount|registration",
+		"aulimit": "max",
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("list", "allusers")
+
+	return w.queryEach(q, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				AllUsers []UserDetail `json:"allusers"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, user := range r.Query.AllUsers {
+			if err := f(user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// StashedFile is a file in the current user's upload stash, as returned by
+// list=mystashedfiles. Files are stashed by uploads that have not been
+// completed yet, e.g. interrupted chunked uploads.
+type StashedFile struct {
+	FileKey string `json:"filekey"`
+	// Status is the status of the upload, e.g. "finished" or "chunks".
+	Status   string `json:"status"`
+	Size     int    `json:"size"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MIMEType string `json:"mimetype"`
+}
+
+// StashedFiles lists the files in the current user's upload stash
+// (list=mystashedfiles), calling f with each file. The client must be logged
+// in.
+// See https://www.mediawiki.org/wiki/API:Mystashedfiles
+func (w *Client) StashedFiles(f func(file StashedFile) error) error {
+	p := params.Values{
+		"list":     "mystashedfiles",
+		"msfprop":  "size|type",
+		"msflimit": "max",
+	}
+
+	return w.queryEach(p, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				StashedFiles []StashedFile `json:"mystashedfiles"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, file := range r.Query.StashedFiles {
+			if err := f(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// QueryPage calls f with the titles of the pages listed by the query special
+// page name (list=querypage), e.g. "Lonelypages", "Deadendpages", or
+// "Wantedpages". f is called with at most limit titles; if limit is zero or
+// negative, it is called with all titles. Some query pages are cached, and the
+// results may be outdated. If name is not a valid query page, an error listing
+// the valid names, as reported by action=paraminfo, is returned.
+func (w *Client) QueryPage(name string, limit int, f func(title string) error) error {
+	p := params.Values{
+		"list":    "querypage",
+		"qppage":  name,
+		"qplimit": "max",
+	}
+	if limit > 0 && limit < 500 {
+		p.Set("qplimit", strconv.Itoa(limit))
+	}
+
+	n := 0
+	err := w.queryEach(p, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				QueryPage struct {
+					Results []struct {
+						Title string `json:"title"`
+					} `json:"results"`
+				} `json:"querypage"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, result := range r.Query.QueryPage.Results {
+			if err := f(result.Title); err != nil {
+				return err
+			}
+			if n++; n == limit {
+				return errStopQuery
+			}
+		}
+		return nil
+	})
+	if apierr, ok := err.(APIError); ok && apierr.Code == "badvalue" &&
+		strings.Contains(apierr.Info, "qppage") {
+		names, nerr := w.queryPageNames()
+		if nerr != nil || len(names) == 0 {
+			return fmt.Errorf("unknown query page %q: %s", name, apierr.Info)
+		}
+		return fmt.Errorf("unknown query page %q; valid query pages are: %s", name, strings.Join(names, ", "))
+	}
+	return err
+}
+
+// queryPageNames returns the valid values of the qppage parameter of
+// list=querypage (action=paraminfo).
+func (w *Client) queryPageNames() ([]string, error) {
+	p := params.Values{
+		"action":  "paraminfo",
+		"modules": "query+querypage",
+	}
+	resp, err := w.Get(p)
+	if resp == nil {
+		return nil, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return nil, err
+	}
+
+	var r struct {
+		ParamInfo struct {
+			Modules []struct {
+				Parameters []struct {
+					Name string          `json:"name"`
+					Type json.RawMessage `json:"type"`
+				} `json:"parameters"`
+			} `json:"modules"`
+		} `json:"paraminfo"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+	for _, module := range r.ParamInfo.Modules {
+		for _, param := range module.Parameters {
+			// The type of parameters with a fixed set of values is the list
+			// of the values, and otherwise a string such as "integer".
+			var names []string
+			if param.Name == "page" && json.Unmarshal(param.Type, &names) == nil {
+				return names, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid API response: no qppage values: %v", resp)
+}
+
+// Page is a page and the content of its latest revision, as passed to the
+// callback of AllPagesWithContent.
+type Page struct {
+	PageID    int
+	NS        int
+	Title     string
+	Content   string
+	Timestamp string
+}
+
+// AllPagesWithContent calls f with each page in the namespace and the
+// content of its latest revision (generator=allpages with prop=revisions).
+// The pages are retrieved in batches, and f is called for the pages in a batch
+// once the content of all the pages in the batch has been retrieved.
+// If f returns an error, no further requests are made and
+// AllPagesWithContent returns the error.
+func (w *Client) AllPagesWithContent(namespace int, f func(page Page) error) error {
+	p := params.Values{
+		"generator":    "allpages",
+		"gapnamespace": strconv.Itoa(namespace),
+		"gaplimit":     "max",
+		"prop":         "revisions",
+		"rvprop":       "content|timestamp",
+		"rvslots":      "main",
+	}
+
+	// A batch of pages may be split over several responses if their contents
+	// do not fit in one response, so pages are collected until the response
+	// that completes the batch.
+	var batch []*Page
+	byID := map[int]*Page{}
+	flush := func() error {
+		for _, page := range batch {
+			if err := f(*page); err != nil {
+				return err
+			}
+		}
+		batch = nil
+		byID = map[int]*Page{}
+		return nil
+	}
+
+	err := w.queryEach(p, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				Pages []struct {
+					PageID    int    `json:"pageid"`
+					NS        int    `json:"ns"`
+					Title     string `json:"title"`
+					Revisions []struct {
+						Timestamp string `json:"timestamp"`
+						Slots     struct {
+							Main struct {
+								Content string `json:"content"`
+							} `json:"main"`
+						} `json:"slots"`
+					} `json:"revisions"`
+				} `json:"pages"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+
+		for _, entry := range r.Query.Pages {
+			page, ok := byID[entry.PageID]
+			if !ok {
+				page = &Page{PageID: entry.PageID, NS: entry.NS, Title: entry.Title}
+				byID[entry.PageID] = page
+				batch = append(batch, page)
+			}
+			if len(entry.Revisions) > 0 {
+				page.Content = entry.Revisions[0].Slots.Main.Content
+				page.Timestamp = entry.Revisions[0].Timestamp
+			}
+		}
+
+		if !batchComplete(resp) {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// ProtectedTitle is a title that is protected from creation, as returned by
+// list=protectedtitles.
+type ProtectedTitle struct {
+	NS    int
+	Title string
+	// Level is the user right required to create the page, e.g. "sysop".
+	Level   string
+	User    string
+	Comment string
+	// Timestamp is when the protection was added.
+	Timestamp time.Time
+	// Expiry is when the protection expires. It is the zero time if the
+	// protection does not expire.
+	Expiry time.Time
+}
+
+// ProtectedTitles lists the titles in the namespace that are protected from
+// creation (list=protectedtitles), calling f with each title.
+func (w *Client) ProtectedTitles(namespace int, f func(title ProtectedTitle) error) error {
+	p := params.Values{
+		"list":        "protectedtitles",
+		"ptnamespace": strconv.Itoa(namespace),
+		"ptprop":      "timestamp|user|comment|expiry|level",
+		"ptlimit":     "max",
+	}
+
+	return w.queryEach(p, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				ProtectedTitles []struct {
+					NS        int    `json:"ns"`
+					Title     string `json:"title"`
+					Level     string `json:"level"`
+					User      string `json:"user"`
+					Comment   string `json:"comment"`
+					Timestamp string `json:"timestamp"`
+					Expiry    string `json:"expiry"`
+				} `json:"protectedtitles"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+
+		for _, pt := range r.Query.ProtectedTitles {
+			title := ProtectedTitle{
+				NS:      pt.NS,
+				Title:   pt.Title,
+				Level:   pt.Level,
+				User:    pt.User,
+				Comment: pt.Comment,
+			}
+			var err error
+			if title.Timestamp, err = time.Parse(time.RFC3339, pt.Timestamp); err != nil {
+				return fmt.Errorf("invalid timestamp of protected title %s: %v", pt.Title, err)
+			}
+			if pt.Expiry != "infinity" {
+				if title.Expiry, err = time.Parse(time.RFC3339, pt.Expiry); err != nil {
+					return fmt.Errorf("invalid expiry of protected title %s: %v", pt.Title, err)
+				}
+			}
+			if err := f(title); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WatchlistEntry is a recent change to a page on the current user's
+// watchlist, as returned by list=watchlist.
+type WatchlistEntry struct {
+	// Type is the type of the change: "edit", "new", "log", "external", or
+	// "categorize".
+	Type      string `json:"type"`
+	NS        int    `json:"ns"`
+	Title     string `json:"title"`
+	PageID    int    `json:"pageid"`
+	RevID     int    `json:"revid"`
+	OldRevID  int    `json:"old_revid"`
+	User      string `json:"user"`
+	Timestamp string `json:"timestamp"`
+	Comment   string `json:"comment"`
+}
+
+// Watchlist lists the recent changes to pages on the current user's watchlist
+// (list=watchlist). p may contain any list=watchlist parameters, e.g.
+// "wlnamespace", or "wlstart" and "wlend" to limit the time range. If
+// "wlprop" is not set in p, all the properties of WatchlistEntry are
+// requested. f is called with each entry. The client must be logged in;
+// otherwise, ErrNotLoggedIn is returned.
+// See https://www.mediawiki.org/wiki/API:Watchlist
+func (w *Client) Watchlist(p params.Values, f func(entry WatchlistEntry) error) error {
+	q := params.Values{
+		"wlprop":  "ids|title|user|timestamp|comment",
+		"wllimit": "max",
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("list", "watchlist")
+
+	err := w.queryEach(q, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				Watchlist []WatchlistEntry `json:"watchlist"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, entry := range r.Query.Watchlist {
+			if err := f(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if apierr, ok := err.(APIError); ok && apierr.Code == "notloggedin" {
+		return ErrNotLoggedIn
+	}
+	return err
+}
+
+// RecentChange is a recent change on the wiki, as returned by
+// list=recentchanges.
+type RecentChange struct {
+	// Type is the type of the change: "edit", "new", "log", "external", or
+	// "categorize".
+	Type      string `json:"type"`
+	RCID      int    `json:"rcid"`
+	NS        int    `json:"ns"`
+	Title     string `json:"title"`
+	PageID    int    `json:"pageid"`
+	RevID     int    `json:"revid"`
+	OldRevID  int    `json:"old_revid"`
+	User      string `json:"user"`
+	Timestamp string `json:"timestamp"`
+	Comment   string `json:"comment"`
+}
+
+// RecentChanges lists recent changes on the wiki (list=recentchanges), newest
+// first. p may contain any list=recentchanges parameters, e.g. "rctype",
+// "rcnamespace", or "rcstart" and "rcend" to limit the time range. If "rcprop"
+// is not set in p, all the properties of RecentChange are requested.
+// f is called with at most limit changes, continuing the query as needed; if
+// limit is zero or negative, it is called with all changes.
+// See https://www.mediawiki.org/wiki/API:RecentChanges
+func (w *Client) RecentChanges(p params.Values, limit int, f func(change RecentChange) error) error {
+	q := params.Values{
+		"rcprop":  "ids|title|user|timestamp|comment",
+		"rclimit": "max",
+	}
+	if limit > 0 && limit < 500 {
+		q.Set("rclimit", strconv.Itoa(limit))
+	}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("list", "recentchanges")
+
+	n := 0
+	return w.queryEach(q, func(resp *jason.Object) error {
+		var r struct {
+			Query struct {
+				RecentChanges []RecentChange `json:"recentchanges"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return err
+		}
+		for _, rc := range r.Query.RecentChanges {
+			if err := f(rc); err != nil {
+				return err
+			}
+			if n++; n == limit {
+				return errStopQuery
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,439 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestBlocks(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "blocks" {
+			t.Fatalf("list != blocks: list=%s", v)
+		}
+		if v := r.Form.Get("bkusers"); v != "Vandal" {
+			t.Fatalf("bkusers != Vandal: bkusers=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"blocks":[{"id":42,"user":"Vandal",
+		"by":"Admin","timestamp":"2019-01-01T00:00:00Z","expiry":"infinity",
+		"reason":"spam","automatic":false,"anononly":false,"nocreate":true,
+		"autoblock":true,"noemail":false,"hidden":false,"allowusertalk":false,
+		"partial":false}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var blocks []Block
+	err := client.Blocks(params.Values{"bkusers": "Vandal"}, func(v Block) error {
+		blocks = append(blocks, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Blocks returned error: %v", err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(blocks))
+	}
+	b := blocks[0]
+	if b.ID != 42 || b.By != "Admin" || b.Expiry != "infinity" {
+		t.Errorf("unexpected block: %+v", b)
+	}
+	if !b.NoCreate || !b.AutoBlock || b.AnonOnly {
+		t.Errorf("block flags not parsed correctly: %+v", b)
+	}
+}
+
+func TestAllUsers(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("augroup"); v != "sysop" {
+			t.Fatalf("augroup != sysop: augroup=%s", v)
+		}
+
+		if reqCount == 0 {
+			fmt.Fprint(w, `{"continue":{"aufrom":"B","continue":"-||"},"query":{"allusers":[
+			{"userid":1,"name":"A","editcount":10,"registration":"2010-01-01T00:00:00Z",
+			"groups":["sysop","*","user"]}]}}`)
+		} else {
+			if v := r.Form.Get("aufrom"); v != "B" {
+				t.Fatalf("aufrom != B: aufrom=%s", v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"allusers":[
+			{"userid":2,"name":"B","editcount":20,"registration":"2011-01-01T00:00:00Z",
+			"groups":["bureaucrat","sysop","*","user"]}]}}`)
+		}
+		reqCount++
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var users []UserDetail
+	err := client.AllUsers(params.Values{"augroup": "sysop"}, func(v UserDetail) error {
+		users = append(users, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AllUsers returned error: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+	if u := users[1]; u.ID != 2 || u.EditCount != 20 || len(u.Groups) != 4 {
+		t.Errorf("unexpected second user: %+v", u)
+	}
+}
+
+func TestStashedFiles(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "mystashedfiles" {
+			t.Fatalf("list != mystashedfiles: list=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"mystashedfiles":[
+		{"filekey":"1a2b3c.jpg","status":"finished","size":1024,"width":100,"height":50,"mimetype":"image/jpeg"},
+		{"filekey":"4d5e6f.webm","status":"chunks","size":0,"width":0,"height":0,"mimetype":"unknown/unknown"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var files []StashedFile
+	err := client.StashedFiles(func(v StashedFile) error {
+		files = append(files, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StashedFiles returned error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d: %v", len(files), files)
+	}
+	if f := files[0]; f.FileKey != "1a2b3c.jpg" || f.Size != 1024 || f.MIMEType != "image/jpeg" {
+		t.Fatalf("unexpected file: %#v", f)
+	}
+	if files[1].Status != "chunks" {
+		t.Fatalf("files[1].Status != chunks: files[1].Status=%s", files[1].Status)
+	}
+}
+
+func TestQueryPage(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("qppage"); v != "Lonelypages" {
+			t.Fatalf("qppage != Lonelypages: qppage=%s", v)
+		}
+		if v := r.Form.Get("qplimit"); v != "3" {
+			t.Fatalf("qplimit != 3: qplimit=%s", v)
+		}
+
+		reqCount++
+		if reqCount == 1 {
+			fmt.Fprint(w, `{"continue":{"qpoffset":2,"continue":"-||"},"query":{"querypage":{"name":"Lonelypages",
+			"results":[{"value":"0","ns":0,"title":"A"},{"value":"0","ns":0,"title":"B"}]}}}`)
+		} else {
+			fmt.Fprint(w, `{"continue":{"qpoffset":4,"continue":"-||"},"query":{"querypage":{"name":"Lonelypages",
+			"results":[{"value":"0","ns":0,"title":"C"},{"value":"0","ns":0,"title":"D"}]}}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var titles []string
+	err := client.QueryPage("Lonelypages", 3, func(v string) error {
+		titles = append(titles, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QueryPage returned error: %v", err)
+	}
+	if fmt.Sprint(titles) != "[A B C]" {
+		t.Fatalf("titles != [A B C]: titles=%v", titles)
+	}
+	if reqCount != 2 {
+		t.Fatalf("expected 2 requests, got %d", reqCount)
+	}
+}
+
+func TestQueryPageUnknown(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("action") == "paraminfo" {
+			if v := r.Form.Get("modules"); v != "query+querypage" {
+				t.Fatalf("modules != query+querypage: modules=%s", v)
+			}
+			fmt.Fprint(w, `{"paraminfo":{"modules":[{"name":"querypage","path":"query+querypage",
+			"parameters":[{"index":1,"name":"page","type":["Ancientpages","Lonelypages"],"required":true},
+			{"index":2,"name":"offset","type":"string"}]}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"error":{"code":"badvalue",
+		"info":"Unrecognized value for parameter \"qppage\": Nonexistent."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	err := client.QueryPage("Nonexistent", 0, func(string) error { return nil })
+	want := `unknown query page "Nonexistent"; valid query pages are: Ancientpages, Lonelypages`
+	if err == nil || err.Error() != want {
+		t.Fatalf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestAllPagesWithContent(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("generator"); v != "allpages" {
+			t.Fatalf("generator != allpages: generator=%s", v)
+		}
+		if v := r.Form.Get("gapnamespace"); v != "4" {
+			t.Fatalf("gapnamespace != 4: gapnamespace=%s", v)
+		}
+
+		reqCount++
+		switch reqCount {
+		case 1:
+			// The content of B did not fit in the response.
+			fmt.Fprint(w, `{"continue":{"rvcontinue":"2|2","continue":"gapcontinue||"},"query":{"pages":[
+			{"pageid":1,"ns":4,"title":"Project:A","revisions":[{"timestamp":"2026-01-01T00:00:00Z","slots":{"main":{"content":"a"}}}]},
+			{"pageid":2,"ns":4,"title":"Project:B"}]}}`)
+		case 2:
+			fmt.Fprint(w, `{"batchcomplete":true,"continue":{"gapcontinue":"C","continue":"gapcontinue||"},"query":{"pages":[
+			{"pageid":1,"ns":4,"title":"Project:A"},
+			{"pageid":2,"ns":4,"title":"Project:B","revisions":[{"timestamp":"2026-01-02T00:00:00Z","slots":{"main":{"content":"b"}}}]}]}}`)
+		default:
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+			{"pageid":3,"ns":4,"title":"Project:C","revisions":[{"timestamp":"2026-01-03T00:00:00Z","slots":{"main":{"content":"c"}}}]}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var pages []Page
+	err := client.AllPagesWithContent(4, func(page Page) error {
+		if page.Content == "" {
+			t.Errorf("page passed to callback without content: %+v", page)
+		}
+		pages = append(pages, page)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AllPagesWithContent returned error: %v", err)
+	}
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 pages, got %d: %+v", len(pages), pages)
+	}
+	if pages[1].Title != "Project:B" || pages[1].Content != "b" {
+		t.Fatalf("unexpected page: %+v", pages[1])
+	}
+}
+
+func TestProtectedTitles(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "protectedtitles" {
+			t.Fatalf("list != protectedtitles: list=%s", v)
+		}
+		if v := r.Form.Get("ptnamespace"); v != "0" {
+			t.Fatalf("ptnamespace != 0: ptnamespace=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"protectedtitles":[
+		{"ns":0,"title":"Salted","timestamp":"2020-01-01T00:00:00Z","user":"Admin","comment":"spam","expiry":"infinity","level":"sysop"},
+		{"ns":0,"title":"Temporary","timestamp":"2026-01-01T00:00:00Z","user":"Admin","comment":"","expiry":"2027-01-01T00:00:00Z","level":"autoconfirmed"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var titles []ProtectedTitle
+	err := client.ProtectedTitles(0, func(v ProtectedTitle) error {
+		titles = append(titles, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ProtectedTitles returned error: %v", err)
+	}
+	if len(titles) != 2 {
+		t.Fatalf("expected 2 titles, got %d: %v", len(titles), titles)
+	}
+	if pt := titles[0]; pt.Title != "Salted" || pt.Level != "sysop" || !pt.Expiry.IsZero() {
+		t.Errorf("unexpected protected title: %+v", pt)
+	}
+	if pt := titles[1]; !pt.Expiry.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry: %v", pt.Expiry)
+	}
+}
+
+func TestWatchlist(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "watchlist" {
+			t.Fatalf("list != watchlist: list=%s", v)
+		}
+		if v := r.Form.Get("wlnamespace"); v != "0" {
+			t.Fatalf("wlnamespace != 0: wlnamespace=%s", v)
+		}
+
+		reqCount++
+		if reqCount == 1 {
+			fmt.Fprint(w, `{"continue":{"wlcontinue":"20260101000000|2","continue":"-||"},
+			"query":{"watchlist":[{"type":"edit","ns":0,"title":"Foo","pageid":1,"revid":11,
+			"old_revid":10,"user":"Editor","timestamp":"2026-01-02T00:00:00Z","comment":"fix"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"watchlist":[{"type":"new","ns":0,
+		"title":"Bar","pageid":2,"revid":5,"old_revid":0,"user":"Creator",
+		"timestamp":"2026-01-01T00:00:00Z","comment":"new page"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var entries []WatchlistEntry
+	p := params.Values{"wlnamespace": "0"}
+	err := client.Watchlist(p, func(v WatchlistEntry) error {
+		entries = append(entries, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Watchlist returned error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if len(p) != 1 {
+		t.Fatalf("Watchlist modified p: %v", p)
+	}
+	if e := entries[0]; e.Type != "edit" || e.RevID != 11 || e.OldRevID != 10 || e.Title != "Foo" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e := entries[1]; e.Type != "new" || e.Timestamp != "2026-01-01T00:00:00Z" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+}
+
+func TestWatchlistNotLoggedIn(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":{"code":"notloggedin",
+		"info":"You must be logged in to have a watchlist."}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	if err := client.Watchlist(nil, func(WatchlistEntry) error { return nil }); err != ErrNotLoggedIn {
+		t.Fatalf("err != ErrNotLoggedIn: err=%v", err)
+	}
+}
+
+func TestRecentChanges(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "recentchanges" {
+			t.Fatalf("list != recentchanges: list=%s", v)
+		}
+		if v := r.Form.Get("rctype"); v != "edit|new" {
+			t.Fatalf("rctype != edit|new: rctype=%s", v)
+		}
+		if v := r.Form.Get("rclimit"); v != "3" {
+			t.Fatalf("rclimit != 3: rclimit=%s", v)
+		}
+
+		reqCount++
+		if reqCount == 1 {
+			fmt.Fprint(w, `{"continue":{"rccontinue":"20260101000000|3","continue":"-||"},
+			"query":{"recentchanges":[
+			{"type":"edit","ns":0,"title":"Foo","pageid":1,"revid":11,"old_revid":10,"rcid":5,
+			"user":"Editor","timestamp":"2026-01-02T00:00:00Z","comment":"fix"},
+			{"type":"new","ns":0,"title":"Bar","pageid":2,"revid":9,"old_revid":0,"rcid":4,
+			"user":"Creator","timestamp":"2026-01-01T12:00:00Z","comment":"new"}]}}`)
+			return
+		}
+		if v := r.Form.Get("rccontinue"); v != "20260101000000|3" {
+			t.Fatalf("rccontinue != 20260101000000|3: rccontinue=%s", v)
+		}
+		fmt.Fprint(w, `{"continue":{"rccontinue":"20260101000000|1","continue":"-||"},
+		"query":{"recentchanges":[
+		{"type":"edit","ns":0,"title":"Baz","pageid":3,"revid":8,"old_revid":7,"rcid":3,
+		"user":"Editor","timestamp":"2026-01-01T00:00:00Z","comment":"typo"},
+		{"type":"edit","ns":0,"title":"Qux","pageid":4,"revid":6,"old_revid":5,"rcid":2,
+		"user":"Editor","timestamp":"2025-12-31T00:00:00Z","comment":"typo"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var changes []RecentChange
+	p := params.Values{"rctype": "edit|new"}
+	err := client.RecentChanges(p, 3, func(v RecentChange) error {
+		changes = append(changes, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RecentChanges returned error: %v", err)
+	}
+	if len(changes) != 3 || reqCount != 2 {
+		t.Fatalf("expected 3 changes from 2 requests, got %d from %d", len(changes), reqCount)
+	}
+	if len(p) != 1 {
+		t.Fatalf("RecentChanges modified p: %v", p)
+	}
+	if c := changes[0]; c.Type != "edit" || c.RevID != 11 || c.OldRevID != 10 || c.User != "Editor" {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+	if c := changes[2]; c.Title != "Baz" || c.Comment != "typo" {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+}
@@ -0,0 +1,384 @@
+package mwclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// ErrImageNotRotatable is returned by Client.RotateImage when the file cannot
+// be rotated, e.g. because its file type does not support rotation.
+var ErrImageNotRotatable = errors.New("file cannot be rotated")
+
+// RotateImage rotates the file title (e.g., "File:Example.jpg") clockwise by
+// degrees, which must be 90, 180, or 270 (action=imagerotate), and returns
+// the API response. Image rotation must be enabled on the wiki.
+// If the file cannot be rotated, ErrImageNotRotatable is returned. If the
+// client does not have the right to rotate files, a PermissionError is
+// returned.
+func (w *Client) RotateImage(title string, degrees int) (*jason.Object, error) {
+	if degrees != 90 && degrees != 180 && degrees != 270 {
+		return nil, fmt.Errorf("invalid rotation %d: must be 90, 180 or 270 degrees", degrees)
+	}
+
+	p := params.Values{
+		"action":   "imagerotate",
+		"titles":   title,
+		"rotation": strconv.Itoa(degrees),
+	}
+
+	resp, err := w.postWithToken(CSRFToken, p)
+	if apierr, ok := err.(APIError); ok && strings.Contains(apierr.Code, "nonrotatable") {
+		return nil, ErrImageNotRotatable
+	}
+	if err != nil || w.DryRun {
+		return resp, err
+	}
+
+	var r struct {
+		ImageRotate []struct {
+			Result       string `json:"result"`
+			ErrorMessage string `json:"errormessage"`
+			Errors       []struct {
+				Code string `json:"code"`
+			} `json:"errors"`
+		} `json:"imagerotate"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return resp, err
+	}
+	for _, result := range r.ImageRotate {
+		if result.Result == "Success" {
+			continue
+		}
+		for _, e := range result.Errors {
+			if strings.Contains(e.Code, "nonrotatable") {
+				return resp, ErrImageNotRotatable
+			}
+		}
+		return resp, fmt.Errorf("unable to rotate %s: %s", title, result.ErrorMessage)
+	}
+
+	return resp, nil
+}
+
+// UploadWarningError is returned by Client.Upload when the file was not
+// uploaded because of warnings, e.g. because a file with the same name or
+// identical content already exists.
+type UploadWarningError struct {
+	// Warnings maps warning codes (e.g., "exists" or "duplicate") to
+	// information about the warning, whose format depends on the warning.
+	Warnings *jason.Object
+	// FileKey is the key of the file in the upload stash, if it was stashed.
+	// The upload can be completed despite the warnings by uploading again
+	// with the 'filekey' and 'ignorewarnings' parameters.
+	FileKey string
+}
+
+func (e UploadWarningError) Error() string {
+	var codes []string
+	if e.Warnings != nil {
+		for code := range e.Warnings.Map() {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return "upload warnings: " + strings.Join(codes, ", ")
+}
+
+// Upload uploads a file with the name filename (without the "File:" prefix)
+// and the content read from content (action=upload), and returns the API
+// response. The p argument may contain further parameters from
+// https://www.mediawiki.org/wiki/API:Upload#Parameters, e.g. 'comment' and
+// 'text'. Upload sets the 'action', 'filename', and 'token' parameters.
+// The request is sent as multipart/form-data, and content is streamed to
+// the server while it is read, so large files are not buffered in memory.
+// Because content can only be read once, the request is not retried because
+// of maxlag or an invalid token, but a rejected token is removed from the
+// token cache.
+// If the API returns warnings instead of uploading the file, the response is
+// returned along with an UploadWarningError. If the upload requires solving
+// a CAPTCHA, a CaptchaError is returned; as content cannot be sent again, the
+// upload has to be retried by the caller, with the answer set in p (see
+// CaptchaError.Answer).
+func (w *Client) Upload(filename string, content io.Reader, p params.Values) (*jason.Object, error) {
+	fields := params.Values{}
+	for k, v := range p {
+		fields[k] = v
+	}
+	fields["action"] = "upload"
+	fields["filename"] = filename
+
+	if w.DryRun {
+		w.logf("mwclient: dry run: not uploading file: %s", fields.Encode())
+		return jason.NewObjectFromBytes([]byte(`{"upload":{"result":"Success"}}`))
+	}
+
+	if fields["token"] == "" {
+		token, err := w.GetToken(CSRFToken)
+		if err != nil {
+			return nil, fmt.Errorf("unable to obtain %s token: %s", CSRFToken, err)
+		}
+		fields["token"] = token
+	}
+
+	// The multipart body is written to the request while it is sent.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUploadBody(mw, fields, "file", filename, content))
+	}()
+
+	resp, err := w.callJSONWithOptions(params.Values{"action": "upload"}, callOptions{
+		bodyReader:  pr,
+		contentType: mw.FormDataContentType(),
+	})
+	if err != nil {
+		// The upload cannot be retried, but the next request should not
+		// be sent with a rejected token.
+		w.invalidateToken(CSRFToken, err, fields["token"])
+		return resp, err
+	}
+
+	return resp, uploadResultError(resp, "Success")
+}
+
+// uploadResultError returns nil if the result of the upload in resp is one
+// of accepted, and otherwise the error described by the response.
+func uploadResultError(resp *jason.Object, accepted ...string) error {
+	var r struct {
+		Upload struct {
+			Result  string `json:"result"`
+			FileKey string `json:"filekey"`
+		} `json:"upload"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return err
+	}
+	for _, a := range accepted {
+		if r.Upload.Result == a {
+			return nil
+		}
+	}
+	if r.Upload.Result == "Warning" {
+		warnings, _ := resp.GetObject("upload", "warnings")
+		return UploadWarningError{Warnings: warnings, FileKey: r.Upload.FileKey}
+	}
+	if captcha, err := resp.GetObject("upload", "captcha"); err == nil {
+		return newCaptchaError(captcha)
+	}
+	return fmt.Errorf("unrecognized response: %v", resp)
+}
+
+// UploadChunked uploads a file like Upload, but sends the size bytes read
+// from content in chunks of at most chunkSize bytes, which allows uploading
+// files larger than the server's maximum request size. The chunks are
+// stored in the upload stash (stash=1), and once all have been sent the file
+// is published from the stash with the parameters in p, e.g. 'comment' and
+// 'text'. If progress is not nil, it is called with the number of bytes
+// sent after each chunk.
+// Each chunk is buffered in memory, so, unlike with Upload, the chunk
+// requests use maxlag and are sent again if the server is lagged.
+// If the API returns warnings, the response is returned along with an
+// UploadWarningError, whose FileKey can be used to publish the stashed file
+// despite the warnings.
+func (w *Client) UploadChunked(filename string, content io.Reader, size, chunkSize int64, p params.Values, progress func(sent int64)) (*jason.Object, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size: %d", chunkSize)
+	}
+
+	fields := params.Values{
+		"action":   "upload",
+		"stash":    "1",
+		"filename": filename,
+		"filesize": strconv.FormatInt(size, 10),
+	}
+	final := params.Values{}
+	for k, v := range p {
+		final[k] = v
+	}
+	final["action"] = "upload"
+	final["filename"] = filename
+
+	if w.DryRun {
+		w.logf("mwclient: dry run: not uploading file: %s", final.Encode())
+		return jason.NewObjectFromBytes([]byte(`{"upload":{"result":"Success"}}`))
+	}
+
+	token := p["token"]
+	if token == "" {
+		var err error
+		token, err = w.GetToken(CSRFToken)
+		if err != nil {
+			return nil, fmt.Errorf("unable to obtain %s token: %s", CSRFToken, err)
+		}
+	}
+	fields["token"] = token
+
+	var offset int64
+	var fileKey string
+	buf := make([]byte, chunkSize)
+	for offset < size {
+		n := chunkSize
+		if size-offset < n {
+			n = size - offset
+		}
+		if _, err := io.ReadFull(content, buf[:n]); err != nil {
+			return nil, fmt.Errorf("unable to read chunk at offset %d: %s", offset, err)
+		}
+		fields["offset"] = strconv.FormatInt(offset, 10)
+		if fileKey != "" {
+			fields["filekey"] = fileKey
+		}
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if err := writeUploadBody(mw, fields, "chunk", filename, bytes.NewReader(buf[:n])); err != nil {
+			return nil, err
+		}
+		resp, err := w.callJSONWithOptions(params.Values{"action": "upload"}, callOptions{
+			body:        body.Bytes(),
+			contentType: mw.FormDataContentType(),
+		})
+		if err != nil {
+			w.invalidateToken(CSRFToken, err, token)
+			return resp, err
+		}
+		if err := uploadResultError(resp, "Continue", "Success"); err != nil {
+			return resp, err
+		}
+
+		if fileKey, err = resp.GetString("upload", "filekey"); err != nil {
+			return resp, fmt.Errorf("unrecognized response: %v", resp)
+		}
+		offset += n
+		if next, err := resp.GetInt64("upload", "offset"); err == nil && next != offset {
+			return resp, fmt.Errorf("server expects chunk at offset %d, not %d", next, offset)
+		}
+		if progress != nil {
+			progress(offset)
+		}
+	}
+
+	final["filekey"] = fileKey
+	resp, err := w.postWithToken(CSRFToken, final)
+	if err != nil {
+		return resp, err
+	}
+	return resp, uploadResultError(resp, "Success")
+}
+
+// writeUploadBody writes fields and the file content, as the part named
+// field, to mw and closes it.
+func writeUploadBody(mw *multipart.Writer, fields params.Values, field, filename string, content io.Reader) error {
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+	part, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// ErrNotAFile is returned by Client.ImageInfo when the page is not a file.
+var ErrNotAFile = errors.New("page is not a file")
+
+// ImageInfo is information about the current version of a file, as returned
+// by Client.ImageInfo.
+type ImageInfo struct {
+	Title string `json:"-"`
+	// URL is the URL of the original file.
+	URL string `json:"url"`
+	// DescriptionURL is the URL of the file description page.
+	DescriptionURL string `json:"descriptionurl"`
+	// ThumbURL, ThumbWidth and ThumbHeight describe a thumbnail of the file
+	// if one was requested.
+	ThumbURL    string `json:"thumburl"`
+	ThumbWidth  int    `json:"thumbwidth"`
+	ThumbHeight int    `json:"thumbheight"`
+	MIME        string `json:"mime"`
+	Size        int    `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	SHA1        string `json:"sha1"`
+	// Timestamp is when the current version was uploaded, and User is the
+	// user who uploaded it.
+	Timestamp string `json:"timestamp"`
+	User      string `json:"user"`
+}
+
+// ImageInfo returns information about the file title (e.g.,
+// "File:Example.jpg"), such as its URL, size, MIME type and SHA-1 hash
+// (prop=imageinfo). If thumbWidth is greater than 0, the URL of a thumbnail
+// scaled to that width is included as well.
+// Files from a shared repository (such as Wikimedia Commons) are found even
+// if they have no description page on the wiki. If the file does not exist,
+// ErrPageNotFound is returned, and if the page is not in the File namespace,
+// ErrNotAFile is returned.
+func (w *Client) ImageInfo(title string, thumbWidth int) (ImageInfo, error) {
+	p := params.Values{
+		"action": "query",
+		"prop":   "imageinfo",
+		"titles": title,
+		"iiprop": "url|size|mime|sha1|timestamp|user",
+	}
+	if thumbWidth > 0 {
+		p["iiurlwidth"] = strconv.Itoa(thumbWidth)
+	}
+
+	resp, err := w.Get(p)
+	if resp == nil {
+		return ImageInfo{}, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return ImageInfo{}, err
+	}
+	warnings := err
+
+	var r struct {
+		Query struct {
+			Pages []struct {
+				NS        int         `json:"ns"`
+				Title     string      `json:"title"`
+				Missing   bool        `json:"missing"`
+				Invalid   bool        `json:"invalid"`
+				ImageInfo []ImageInfo `json:"imageinfo"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return ImageInfo{}, err
+	}
+	if len(r.Query.Pages) == 0 {
+		return ImageInfo{}, fmt.Errorf("invalid API response: no page information: %v", resp)
+	}
+
+	page := r.Query.Pages[0]
+	switch {
+	case page.Invalid:
+		return ImageInfo{}, errors.New("invalid page title: " + title)
+	case page.NS != 6:
+		return ImageInfo{}, ErrNotAFile
+	case len(page.ImageInfo) == 0:
+		return ImageInfo{}, ErrPageNotFound
+	}
+	info := page.ImageInfo[0]
+	info.Title = page.Title
+	return info, warnings
+}
@@ -0,0 +1,234 @@
+package mwclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestRotateImage(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "imagerotate" {
+			t.Fatalf("action != imagerotate: action=%s", v)
+		}
+		if v := r.Form.Get("rotation"); v != "90" {
+			t.Fatalf("rotation != 90: rotation=%s", v)
+		}
+
+		if r.Form.Get("titles") == "File:Example.svg" {
+			fmt.Fprint(w, `{"imagerotate":[{"ns":6,"title":"File:Example.svg","result":"Failure",
+			"errormessage":"This file cannot be rotated.","errors":[{"code":"imagerotate-nonrotatable"}]}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"imagerotate":[{"ns":6,"title":"File:Example.jpg","result":"Success"}]}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if _, err := client.RotateImage("File:Example.jpg", 90); err != nil {
+		t.Fatalf("RotateImage returned error: %v", err)
+	}
+	if _, err := client.RotateImage("File:Example.svg", 90); err != ErrImageNotRotatable {
+		t.Fatalf("expected ErrImageNotRotatable, got %v", err)
+	}
+	if _, err := client.RotateImage("File:Example.jpg", 45); err == nil {
+		t.Fatal("RotateImage accepted invalid rotation")
+	}
+}
+
+func TestUpload(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.PostForm.Get("action"); v != "upload" {
+			t.Fatalf("action != upload: action=%s", v)
+		}
+		if v := r.PostForm.Get("token"); v != "VALIDTOKEN" {
+			t.Fatalf("token != VALIDTOKEN: token=%s", v)
+		}
+		if v := r.PostForm.Get("comment"); v != "Upload comment" {
+			t.Fatalf("comment != Upload comment: comment=%s", v)
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("file part missing: %v", err)
+		}
+		content, _ := ioutil.ReadAll(f)
+		if string(content) != "file content" {
+			t.Fatalf("file content != file content: content=%s", content)
+		}
+
+		if r.PostForm.Get("filename") == "Captcha.txt" {
+			fmt.Fprint(w, `{"upload":{"result":"Failure","captcha":{"type":"image","mime":"image/png",`+
+				`"id":"42","url":"/index.php?title=Special:Captcha/image&wpCaptchaId=42"}}}`)
+			return
+		}
+		if r.PostForm.Get("filename") == "Exists.txt" {
+			fmt.Fprint(w, `{"upload":{"result":"Warning","warnings":{"exists":"Exists.txt"},"filekey":"abc.txt"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"upload":{"result":"Success","filename":"Example.txt"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	p := params.Values{"comment": "Upload comment"}
+	if _, err := client.Upload("Example.txt", strings.NewReader("file content"), p); err != nil {
+		t.Fatalf("Upload returned error: %v", err)
+	}
+
+	_, err := client.Upload("Exists.txt", strings.NewReader("file content"), p)
+	e, ok := err.(UploadWarningError)
+	if !ok {
+		t.Fatalf("expected UploadWarningError, got %v", err)
+	}
+	if e.FileKey != "abc.txt" {
+		t.Fatalf("FileKey != abc.txt: FileKey=%s", e.FileKey)
+	}
+	if e.Error() != "upload warnings: exists" {
+		t.Fatalf("unexpected error message: %s", e.Error())
+	}
+
+	_, err = client.Upload("Captcha.txt", strings.NewReader("file content"), p)
+	if captcha, ok := err.(CaptchaError); !ok || captcha.ID != "42" {
+		t.Fatalf("expected CaptchaError with ID 42, got %#v", err)
+	}
+}
+
+func TestUploadChunked(t *testing.T) {
+	content := "0123456789"
+	var chunks []string
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.PostForm.Get("token"); v != "VALIDTOKEN" {
+			t.Fatalf("token != VALIDTOKEN: token=%s", v)
+		}
+		if r.PostForm.Get("stash") == "" {
+			if v := r.PostForm.Get("filekey"); v != "key3" {
+				t.Fatalf("filekey != key3: filekey=%s", v)
+			}
+			if v := r.PostForm.Get("comment"); v != "Upload comment" {
+				t.Fatalf("comment != Upload comment: comment=%s", v)
+			}
+			fmt.Fprint(w, `{"upload":{"result":"Success","filename":"Example.txt"}}`)
+			return
+		}
+
+		if v := r.PostForm.Get("filesize"); v != "10" {
+			t.Fatalf("filesize != 10: filesize=%s", v)
+		}
+		if v, want := r.PostForm.Get("offset"), strconv.Itoa(len(chunks)*4); v != want {
+			t.Fatalf("offset != %s: offset=%s", want, v)
+		}
+		if v, want := r.PostForm.Get("filekey"), fmt.Sprintf("key%d", len(chunks)); len(chunks) > 0 && v != want {
+			t.Fatalf("filekey != %s: filekey=%s", want, v)
+		}
+		f, _, err := r.FormFile("chunk")
+		if err != nil {
+			t.Fatalf("chunk part missing: %v", err)
+		}
+		chunk, _ := ioutil.ReadAll(f)
+		chunks = append(chunks, string(chunk))
+
+		if len(chunks) < 3 {
+			fmt.Fprintf(w, `{"upload":{"result":"Continue","offset":%d,"filekey":"key%d"}}`, len(chunks)*4, len(chunks))
+			return
+		}
+		fmt.Fprint(w, `{"upload":{"result":"Success","filekey":"key3"}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	p := params.Values{"comment": "Upload comment"}
+	var sent []int64
+	progress := func(n int64) { sent = append(sent, n) }
+	_, err := client.UploadChunked("Example.txt", strings.NewReader(content), int64(len(content)), 4, p, progress)
+	if err != nil {
+		t.Fatalf("UploadChunked returned error: %v", err)
+	}
+	if strings.Join(chunks, "|") != "0123|4567|89" {
+		t.Fatalf("unexpected chunks: %q", chunks)
+	}
+	if fmt.Sprint(sent) != "[4 8 10]" {
+		t.Fatalf("unexpected progress: %v", sent)
+	}
+	if _, ok := p["filekey"]; ok {
+		t.Fatalf("UploadChunked modified p: %v", p)
+	}
+}
+
+func TestImageInfo(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("prop"); v != "imageinfo" {
+			t.Fatalf("prop != imageinfo: prop=%s", v)
+		}
+		switch r.Form.Get("titles") {
+		case "File:Example.jpg":
+			if v := r.Form.Get("iiurlwidth"); v != "100" {
+				t.Fatalf("iiurlwidth != 100: iiurlwidth=%s", v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":6,"title":"File:Example.jpg",
+			"missing":true,"known":true,"imagerepository":"shared","imageinfo":[{
+			"timestamp":"2020-01-01T00:00:00Z","user":"Uploader","size":1000,"width":200,"height":100,
+			"thumburl":"https://example.org/thumb/100px-Example.jpg","thumbwidth":100,"thumbheight":50,
+			"url":"https://example.org/Example.jpg","descriptionurl":"https://example.org/wiki/File:Example.jpg",
+			"sha1":"da39a3ee5e6b4b0d3255bfef95601890afd80709","mime":"image/jpeg"}]}]}}`)
+		case "File:Missing.jpg":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"ns":6,"title":"File:Missing.jpg",
+			"missing":true,"imagerepository":""}]}}`)
+		default:
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,"title":"Example"}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	info, err := client.ImageInfo("File:Example.jpg", 100)
+	if err != nil {
+		t.Fatalf("ImageInfo returned error: %v", err)
+	}
+	if info.Title != "File:Example.jpg" || info.URL != "https://example.org/Example.jpg" ||
+		info.MIME != "image/jpeg" || info.Width != 200 || info.Height != 100 || info.User != "Uploader" {
+		t.Fatalf("unexpected image info: %+v", info)
+	}
+	if info.ThumbURL != "https://example.org/thumb/100px-Example.jpg" || info.ThumbWidth != 100 {
+		t.Fatalf("unexpected thumbnail: %+v", info)
+	}
+	if info.SHA1 != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+		t.Fatalf("unexpected SHA1: %s", info.SHA1)
+	}
+
+	if _, err := client.ImageInfo("File:Missing.jpg", 0); err != ErrPageNotFound {
+		t.Fatalf("expected ErrPageNotFound, got %v", err)
+	}
+	if _, err := client.ImageInfo("Example", 0); err != ErrNotAFile {
+		t.Fatalf("expected ErrNotAFile, got %v", err)
+	}
+}
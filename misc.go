@@ -1,13 +1,87 @@
 package mwclient
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
 
-// DumpCookies exports the cookies stored in the client.
+// DumpCookies exports the cookies stored in the client that are sent with
+// requests to the API URL, e.g. session cookies. The cookies can be saved
+// (e.g., encoded as JSON) and loaded with LoadCookies into a new client
+// for the same API URL to continue the session without logging in again.
+// Only the names and values of the cookies are exported.
 func (w *Client) DumpCookies() []*http.Cookie {
 	return w.httpc.Jar.Cookies(w.apiURL)
 }
 
-// LoadCookies imports cookies into the client.
+// LoadCookies imports cookies into the client, associating them with the API
+// URL so that they are sent with subsequent requests. See DumpCookies.
 func (w *Client) LoadCookies(cookies []*http.Cookie) {
 	w.httpc.Jar.SetCookies(w.apiURL, cookies)
 }
+
+// normalizeContent returns content normalized as described for
+// Client.NormalizeContent if it is enabled, and content unchanged otherwise.
+func (w *Client) normalizeContent(content string) string {
+	if !w.NormalizeContent {
+		return content
+	}
+	content = strings.TrimPrefix(content, "\ufeff")
+	return strings.Replace(content, "\r\n", "\n", -1)
+}
+
+// chunk splits s into consecutive slices of at most size elements.
+func chunk(s []string, size int) [][]string {
+	chunks := make([][]string, 0, (len(s)+size-1)/size)
+	for len(s) > size {
+		chunks = append(chunks, s[:size])
+		s = s[size:]
+	}
+	if len(s) > 0 {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
+
+// flightGroup deduplicates concurrent calls of functions with the same key,
+// like golang.org/x/sync/singleflight.
+// The zero value is ready to use.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val string
+	err error
+}
+
+// do calls fn and returns its results. If a call with the same key is
+// already in progress, do waits for it to finish and returns its results
+// instead of calling fn.
+func (g *flightGroup) do(key string, fn func() (string, error)) (string, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.val, c.err
+}
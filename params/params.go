@@ -47,7 +47,7 @@ func (v Values) Set(key, value string) {
 // values associated with key.
 func (v Values) Add(key, value string) {
 	if current, ok := v[key]; ok {
-		v[key] = strings.Join([]string{current, value}, "|")
+		v[key] = JoinMultivalue(append(SplitMultivalue(current), value))
 	} else {
 		v[key] = value
 	}
@@ -57,15 +57,40 @@ func (v Values) Add(key, value string) {
 // It appends to any existing values associated with key.
 func (v Values) AddRange(key string, values ...string) {
 	if current, ok := v[key]; ok {
-		list := make([]string, 0, 1+len(values))
-		list = append(list, current)
+		list := SplitMultivalue(current)
 		list = append(list, values...)
-		v[key] = strings.Join(list, "|")
+		v[key] = JoinMultivalue(list)
 	} else {
-		v[key] = strings.Join(values, "|")
+		v[key] = JoinMultivalue(values)
 	}
 }
 
+// unitSeparator is the alternative separator for multi-value parameters.
+const unitSeparator = "\x1f"
+
+// JoinMultivalue joins values into a multi-value parameter value.
+// The values are separated by pipes, unless one of the values contains a pipe.
+// In that case, the values are separated by U+001F (unit separator) instead,
+// and the result is prefixed with U+001F, as required by the MediaWiki API.
+// See https://www.mediawiki.org/wiki/API:Data_formats#Multivalue_parameters
+func JoinMultivalue(values []string) string {
+	for _, value := range values {
+		if strings.Contains(value, "|") {
+			return unitSeparator + strings.Join(values, unitSeparator)
+		}
+	}
+	return strings.Join(values, "|")
+}
+
+// SplitMultivalue splits a multi-value parameter value into its values.
+// It is the inverse of JoinMultivalue.
+func SplitMultivalue(s string) []string {
+	if strings.HasPrefix(s, unitSeparator) {
+		return strings.Split(s[len(unitSeparator):], unitSeparator)
+	}
+	return strings.Split(s, "|")
+}
+
 // Del deletes the value associated with key.
 func (v Values) Del(key string) {
 	delete(v, key)
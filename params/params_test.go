@@ -4,7 +4,10 @@
 
 package params
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 type EncodeQueryTest struct {
 	m        Values
@@ -119,3 +122,40 @@ func TestQueryValues_Add_Eq_AddRange(t *testing.T) {
 		t.Errorf("a != b. a='%s', b='%s'", ae, be)
 	}
 }
+
+func TestJoinMultivalue(t *testing.T) {
+	if g := JoinMultivalue([]string{"a", "b"}); g != "a|b" {
+		t.Errorf("expected a|b, got %q", g)
+	}
+	if g, e := JoinMultivalue([]string{"a", "b|c"}), "\x1fa\x1fb|c"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+}
+
+func TestSplitMultivalue_Inverse(t *testing.T) {
+	for _, values := range [][]string{
+		{"a"},
+		{"a", "b"},
+		{"a", "b|c", ""},
+	} {
+		got := SplitMultivalue(JoinMultivalue(values))
+		if strings.Join(got, ",") != strings.Join(values, ",") {
+			t.Errorf("SplitMultivalue(JoinMultivalue(%q)) = %q", values, got)
+		}
+	}
+}
+
+func TestQueryValues_AddRange_Pipe(t *testing.T) {
+	v := make(Values)
+	v.Add("titles", "Foo")
+	v.AddRange("titles", "A|B", "Bar")
+
+	if g, e := v.Get("titles"), "\x1fFoo\x1fA|B\x1fBar"; g != e {
+		t.Errorf("expected %q, got %q", e, g)
+	}
+
+	v.Add("titles", "Baz")
+	if g := SplitMultivalue(v.Get("titles")); len(g) != 4 || g[1] != "A|B" {
+		t.Errorf("expected 4 values with A|B second, got %q", g)
+	}
+}
@@ -0,0 +1,185 @@
+package mwclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/antonholmquist/jason"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// ParseSection parses the section section of the latest revision of the page
+// title (action=parse) and returns the "parse" object of the response.
+// Section 0 is the lead section. props are the pieces of information to
+// return (the prop parameter), e.g. "text" or "sections"; if none are given,
+// only the HTML text is returned.
+//
+// Parsing is done by the server and can take a long time for large pages,
+// as all templates used in the wikitext are expanded. Only the wikitext of
+// the section is parsed, and requesting only the props that are needed keeps
+// both the parsing and the response small, so ParseSection is much cheaper
+// than parsing the whole page when only one section is needed.
+//
+// If the page does not exist, ErrPageNotFound is returned. If it does not have
+// the section, ErrNoSuchSection is returned.
+func (w *Client) ParseSection(title string, section int, props []string) (*jason.Object, error) {
+	p := params.Values{
+		"action":  "parse",
+		"page":    title,
+		"section": strconv.Itoa(section),
+	}
+	if len(props) > 0 {
+		p.AddRange("prop", props...)
+	} else {
+		p.Set("prop", "text")
+	}
+
+	resp, err := w.Get(p)
+	if apierr, ok := err.(APIError); ok {
+		switch apierr.Code {
+		case "missingtitle":
+			return nil, ErrPageNotFound
+		case "nosuchsection":
+			return nil, ErrNoSuchSection
+		}
+	}
+	if resp == nil {
+		return nil, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return nil, err
+	}
+
+	parse, perr := resp.GetObject("parse")
+	if perr != nil {
+		return nil, fmt.Errorf("invalid API response: no parse object: %v", resp)
+	}
+	return parse, err
+}
+
+// ErrNothingToParse is returned by Client.Parse when neither a page nor text
+// to parse is given.
+var ErrNothingToParse = errors.New("neither page nor text to parse given")
+
+// ParseResult is the result of parsing a page or wikitext with Client.Parse.
+// Only the fields of the props that were requested are set.
+type ParseResult struct {
+	Title  string
+	PageID int
+	RevID  int
+	// Text is the rendered HTML.
+	Text string
+	// Categories are the names of the categories, without the namespace
+	// prefix and with underscores instead of spaces (e.g.,
+	// "Living_people").
+	Categories []string
+	Sections   []ParsedSection
+	// Links are the titles of the pages linked to.
+	Links []string
+}
+
+// ParsedSection is a section of the parsed page or wikitext.
+type ParsedSection struct {
+	// Level is the heading level, e.g. 2 for "== Heading ==".
+	Level int
+	// Line is the heading text, which may contain HTML formatting.
+	Line string
+	// Number is the section number in the table of contents, e.g. "1.2".
+	Number string
+	// Index is the section number to use with e.g. EditSection. It is
+	// prefixed with "T-" for sections from transcluded templates.
+	Index  string
+	Anchor string
+}
+
+// Parse parses a page or wikitext (action=parse) and returns the result.
+// p must contain either "page" (or "pageid" or "oldid") to parse an existing
+// page, or "text" to parse wikitext, which is parsed as if it were the content
+// of the page "title" if that is given as well. p may contain any other
+// action=parse parameters; if "prop" is not set, the HTML text, categories,
+// sections, and links are requested. Requests with "text" are POSTed, so
+// the text can be long.
+// If p contains neither a page nor text, ErrNothingToParse is returned, and if
+// the page does not exist, ErrPageNotFound is returned.
+func (w *Client) Parse(p params.Values) (ParseResult, error) {
+	q := params.Values{"prop": "text|categories|sections|links"}
+	for k, v := range p {
+		q[k] = v
+	}
+	q.Set("action", "parse")
+
+	var resp *jason.Object
+	var err error
+	switch {
+	case q["text"] != "":
+		if q["contentmodel"] == "" {
+			q.Set("contentmodel", "wikitext")
+		}
+		resp, err = w.PostIdempotent(q)
+	case q["page"] != "" || q["pageid"] != "" || q["oldid"] != "":
+		resp, err = w.Get(q)
+	default:
+		return ParseResult{}, ErrNothingToParse
+	}
+	if apierr, ok := err.(APIError); ok && apierr.Code == "missingtitle" {
+		return ParseResult{}, ErrPageNotFound
+	}
+	if resp == nil {
+		return ParseResult{}, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return ParseResult{}, err
+	}
+	warnings := err
+
+	var r struct {
+		Parse struct {
+			Title      string `json:"title"`
+			PageID     int    `json:"pageid"`
+			RevID      int    `json:"revid"`
+			Text       string `json:"text"`
+			Categories []struct {
+				Category string `json:"category"`
+			} `json:"categories"`
+			Sections []struct {
+				Level  string `json:"level"`
+				Line   string `json:"line"`
+				Number string `json:"number"`
+				Index  string `json:"index"`
+				Anchor string `json:"anchor"`
+			} `json:"sections"`
+			Links []struct {
+				Title string `json:"title"`
+			} `json:"links"`
+		} `json:"parse"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return ParseResult{}, err
+	}
+
+	result := ParseResult{
+		Title:  r.Parse.Title,
+		PageID: r.Parse.PageID,
+		RevID:  r.Parse.RevID,
+		Text:   r.Parse.Text,
+	}
+	for _, cat := range r.Parse.Categories {
+		result.Categories = append(result.Categories, cat.Category)
+	}
+	for _, s := range r.Parse.Sections {
+		level, _ := strconv.Atoi(s.Level)
+		result.Sections = append(result.Sections, ParsedSection{
+			Level:  level,
+			Line:   s.Line,
+			Number: s.Number,
+			Index:  s.Index,
+			Anchor: s.Anchor,
+		})
+	}
+	for _, link := range r.Parse.Links {
+		result.Links = append(result.Links, link.Title)
+	}
+	return result, warnings
+}
@@ -0,0 +1,127 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestParseSection(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("page") == "Missing" {
+			fmt.Fprint(w, `{"error":{"code":"missingtitle","info":"The page you specified doesn't exist."}}`)
+			return
+		}
+		if r.Form.Get("section") == "9" {
+			fmt.Fprint(w, `{"error":{"code":"nosuchsection","info":"There is no section 9 in Large."}}`)
+			return
+		}
+		if r.Form.Get("section") != "2" || r.Form.Get("prop") != "text|sections" {
+			t.Fatalf("unexpected parameters: section=%s, prop=%s", r.Form.Get("section"), r.Form.Get("prop"))
+		}
+		fmt.Fprint(w, `{"parse":{"title":"Large","pageid":1,"text":"<h2>History</h2><p>Text</p>",`+
+			`"sections":[{"toclevel":1,"level":"2","line":"History","number":"1","index":"1"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	parse, err := client.ParseSection("Large", 2, []string{"text", "sections"})
+	if err != nil {
+		t.Fatalf("ParseSection returned error: %v", err)
+	}
+	if text, _ := parse.GetString("text"); text != "<h2>History</h2><p>Text</p>" {
+		t.Fatalf("unexpected text: %s", text)
+	}
+
+	if _, err := client.ParseSection("Large", 9, nil); err != ErrNoSuchSection {
+		t.Fatalf("err != ErrNoSuchSection: err=%v", err)
+	}
+	if _, err := client.ParseSection("Missing", 0, nil); err != ErrPageNotFound {
+		t.Fatalf("err != ErrPageNotFound: err=%v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("action"); v != "parse" {
+			t.Fatalf("action != parse: action=%s", v)
+		}
+		if v := r.Form.Get("prop"); v != "text|categories|sections|links" {
+			t.Fatalf("prop != text|categories|sections|links: prop=%s", v)
+		}
+		switch {
+		case r.Form.Get("page") == "Missing":
+			fmt.Fprint(w, `{"error":{"code":"missingtitle","info":"The page you specified doesn't exist."}}`)
+		case r.Form.Get("page") != "":
+			if r.Method != "GET" {
+				t.Fatalf("page parsed with %s", r.Method)
+			}
+			fmt.Fprint(w, `{"parse":{"title":"Example","pageid":1,"revid":10,"text":"<h2>History</h2>",
+			"categories":[{"sortkey":"","category":"Living_people"}],
+			"sections":[{"toclevel":1,"level":"2","line":"History","number":"1","index":"1",
+			"fromtitle":"Example","byteoffset":0,"anchor":"History"}],
+			"links":[{"ns":0,"title":"Foo","exists":true}]}}`)
+		default:
+			if r.Method != "POST" {
+				t.Fatalf("text parsed with %s", r.Method)
+			}
+			if v := r.Form.Get("contentmodel"); v != "wikitext" {
+				t.Fatalf("contentmodel != wikitext: contentmodel=%s", v)
+			}
+			fmt.Fprintf(w, `{"parse":{"title":"API","pageid":0,"text":%q,"categories":[],"sections":[],"links":[]}}`,
+				"<p>"+r.Form.Get("text")+"</p>")
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	p := params.Values{"page": "Example"}
+	result, err := client.Parse(p)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if result.Title != "Example" || result.RevID != 10 || result.Text != "<h2>History</h2>" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(result.Categories) != 1 || result.Categories[0] != "Living_people" {
+		t.Fatalf("unexpected categories: %v", result.Categories)
+	}
+	if len(result.Sections) != 1 || result.Sections[0].Level != 2 || result.Sections[0].Anchor != "History" {
+		t.Fatalf("unexpected sections: %+v", result.Sections)
+	}
+	if len(result.Links) != 1 || result.Links[0] != "Foo" {
+		t.Fatalf("unexpected links: %v", result.Links)
+	}
+	if len(p) != 1 {
+		t.Fatalf("Parse modified p: %v", p)
+	}
+
+	result, err = client.Parse(params.Values{"text": "Hello"})
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if result.Text != "<p>Hello</p>" {
+		t.Fatalf("unexpected text: %s", result.Text)
+	}
+
+	if _, err := client.Parse(params.Values{"page": "Missing"}); err != ErrPageNotFound {
+		t.Fatalf("err != ErrPageNotFound: err=%v", err)
+	}
+	if _, err := client.Parse(params.Values{"prop": "text"}); err != ErrNothingToParse {
+		t.Fatalf("err != ErrNothingToParse: err=%v", err)
+	}
+}
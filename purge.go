@@ -0,0 +1,120 @@
+package mwclient
+
+import (
+	"strings"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// PurgeResult is the outcome of purging a single page.
+type PurgeResult uint8
+
+// These consts are the possible values of PurgeResult.
+const (
+	// Purged means that the page was purged.
+	Purged PurgeResult = iota
+	// PurgeMissing means that the page does not exist.
+	PurgeMissing
+	// PurgeInvalid means that the title is invalid.
+	PurgeInvalid
+	// PurgeRateLimited means that the page was not purged because the
+	// purge rate limit was exceeded. The page can be purged again later.
+	PurgeRateLimited
+	// PurgeFailed means that the page was not purged for another reason.
+	PurgeFailed
+)
+
+// purgeChunkSize is the maximum amount of titles purged in one request.
+const purgeChunkSize = 50
+
+// Purge purges the cache of the pages titles (action=purge).
+// The titles are purged in chunks of 50 titles per request.
+// Purge returns a map of the input titles to the result of purging that title.
+// If a request fails, Purge returns the results of the requests made so far
+// along with the error. If a request fails because the rate limit was
+// exceeded, the titles in that chunk are marked as PurgeRateLimited
+// instead of returning an error.
+// If w.DryRun is true, no requests are sent, and all titles are reported as
+// Purged.
+func (w *Client) Purge(titles ...string) (map[string]PurgeResult, error) {
+	if len(titles) == 0 {
+		return nil, ErrNoArgs
+	}
+
+	results := make(map[string]PurgeResult, len(titles))
+	for _, chunk := range chunk(titles, purgeChunkSize) {
+		p := params.Values{"action": "purge"}
+		p.AddRange("titles", chunk...)
+
+		if w.DryRun {
+			w.logf("mwclient: dry run: not sending POST request: %s", p.Encode())
+			for _, title := range chunk {
+				results[title] = Purged
+			}
+			continue
+		}
+
+		resp, err := w.Post(p)
+		if apierr, ok := err.(APIError); ok && apierr.Code == "ratelimited" {
+			for _, title := range chunk {
+				results[title] = PurgeRateLimited
+			}
+			continue
+		}
+		warnings, _ := err.(APIWarnings)
+		if err != nil && warnings == nil {
+			return results, err
+		}
+
+		var r struct {
+			Normalized []struct {
+				From string `json:"from"`
+				To   string `json:"to"`
+			} `json:"normalized"`
+			Purge []struct {
+				Title   string `json:"title"`
+				Purged  bool   `json:"purged"`
+				Missing bool   `json:"missing"`
+				Invalid bool   `json:"invalid"`
+			} `json:"purge"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return results, err
+		}
+
+		// A rate limited page has neither "purged" nor "missing" set,
+		// but the response will have a ratelimited warning.
+		rateLimited := false
+		for _, warn := range warnings {
+			if warn.Module == "purge" && strings.Contains(warn.Info, "rate limit") {
+				rateLimited = true
+			}
+		}
+
+		denormalized := make(map[string]string, len(r.Normalized))
+		for _, norm := range r.Normalized {
+			denormalized[norm.To] = norm.From
+		}
+		for _, page := range r.Purge {
+			title := page.Title
+			if input, ok := denormalized[title]; ok {
+				title = input
+			}
+
+			switch {
+			case page.Purged:
+				results[title] = Purged
+			case page.Missing:
+				results[title] = PurgeMissing
+			case page.Invalid:
+				results[title] = PurgeInvalid
+			case rateLimited:
+				results[title] = PurgeRateLimited
+			default:
+				results[title] = PurgeFailed
+			}
+		}
+	}
+
+	return results, nil
+}
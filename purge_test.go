@@ -0,0 +1,79 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPurge(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Method != "POST" {
+			t.Fatalf("purge requests must be posted. Method: %v", r.Method)
+		}
+		titles := strings.Split(r.PostFormValue("titles"), "|")
+		if len(titles) > purgeChunkSize {
+			t.Fatalf("expected at most %d titles per request, got %d",
+				purgeChunkSize, len(titles))
+		}
+
+		if reqCount == 0 {
+			fmt.Fprint(w, `{"batchcomplete":true,"normalized":[{"from":"foo","to":"Foo"}],
+			"purge":[{"ns":0,"title":"Foo","purged":true},{"ns":0,"title":"Bar","missing":true}]}`)
+		} else {
+			fmt.Fprint(w, `{"error":{"code":"ratelimited",
+			"info":"You've exceeded your rate limit. Please wait some time and try again."}}`)
+		}
+		reqCount++
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	titles := []string{"foo", "Bar"}
+	for i := 0; i < purgeChunkSize; i++ {
+		titles = append(titles, fmt.Sprintf("Page %d", i))
+	}
+
+	results, err := client.Purge(titles...)
+	if err != nil {
+		t.Fatalf("Purge returned error: %v", err)
+	}
+	if reqCount != 2 {
+		t.Fatalf("expected 2 requests, got %d", reqCount)
+	}
+	if results["foo"] != Purged {
+		t.Errorf("expected foo to be purged, got %v", results["foo"])
+	}
+	if results["Bar"] != PurgeMissing {
+		t.Errorf("expected Bar to be missing, got %v", results["Bar"])
+	}
+	if r := results[titles[len(titles)-1]]; r != PurgeRateLimited {
+		t.Errorf("expected last title to be rate limited, got %v", r)
+	}
+}
+
+func TestPurgeDryRun(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("request sent in dry run mode: %s", r.URL)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.DryRun = true
+	results, err := client.Purge("Foo", "Bar")
+	if err != nil {
+		t.Fatalf("Purge returned error: %v", err)
+	}
+	if len(results) != 2 || results["Foo"] != Purged || results["Bar"] != Purged {
+		t.Fatalf("unexpected results: %v", results)
+	}
+}
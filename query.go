@@ -1,6 +1,10 @@
 package mwclient
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/antonholmquist/jason"
@@ -44,8 +48,37 @@ type Query struct {
 	params params.Values
 	resp   *jason.Object
 	err    error
+	// Retries specifies how many times a request that fails because of a
+	// transient error (e.g., a network error or a truncated response) is
+	// retried before Next gives up. A retried request continues from the last
+	// successful response, so a long iteration does not have to be restarted
+	// because of one failure. API errors and warnings are never retried.
+	// If Retries is positive, it replaces Client.Retries for the requests
+	// made by the query rather than adding to it. By default, Retries is 0
+	// and Client.Retries applies. The delay between attempts is determined
+	// by Client.SetBackoff.
+	Retries int
+	// If RawContinue is true, the legacy continuation format (rawcontinue=)
+	// is used, in which the continuation parameters are returned in
+	// 'query-continue' per module. RawContinue must be set before the first
+	// call to Next.
+	RawContinue bool
+	// If MaxRounds is positive, Next makes at most MaxRounds requests. If the
+	// query has more results after that, Next returns false and Err returns
+	// ErrContinuationLimit. Setting MaxRounds is recommended for queries whose
+	// result sets may be unexpectedly large. By default, there is no limit.
+	MaxRounds int
+	// rawContinued contains the non-generator continuation parameters set
+	// by the last legacy continuation.
+	rawContinued []string
+	// rounds is the amount of requests made by Next, not counting retries.
+	rounds int
 }
 
+// ErrContinuationLimit is returned by Query.Err when a query has more results
+// than could be retrieved in Query.MaxRounds requests.
+var ErrContinuationLimit = errors.New("query continuation limit reached")
+
 // Err returns the first error encountered by the Next method.
 func (q *Query) Err() error {
 	return q.err
@@ -56,6 +89,29 @@ func (q *Query) Resp() *jason.Object {
 	return q.resp
 }
 
+// BatchComplete reports whether the response retrieved by the Next method
+// completes a batch of results. When a query uses a generator together with
+// prop modules, the data of the pages in one batch (e.g., their revisions) may
+// be split over several responses, and is only complete once BatchComplete
+// returns true. A response may complete a batch and still have continuation
+// parameters for the next batch.
+func (q *Query) BatchComplete() bool {
+	return q.resp != nil && batchComplete(q.resp)
+}
+
+// batchComplete reports whether resp has the batchcomplete flag, which is
+// a boolean in formatversion=2 and an empty string in formatversion=1.
+func batchComplete(resp *jason.Object) bool {
+	v, err := resp.GetValue("batchcomplete")
+	if err != nil {
+		return false
+	}
+	if b, err := v.Boolean(); err == nil {
+		return b
+	}
+	return true
+}
+
 // NewQuery instantiates a new query with the given parameters.
 // Automatically sets action=query and continue= on the provided params.Values.
 func (w *Client) NewQuery(p params.Values) *Query {
@@ -70,6 +126,28 @@ func (w *Client) NewQuery(p params.Values) *Query {
 	}
 }
 
+// get makes the request for the current query parameters, retrying it on
+// transient errors as specified by q.Retries, and stores the response.
+// If all attempts fail, the last successful response is kept.
+func (q *Query) get() bool {
+	q.rounds++
+	// Client.Retries is not applied on top of q.Retries.
+	opts := callOptions{noRetry: q.Retries > 0}
+	resp, err := q.w.callJSONWithOptions(q.params, opts)
+	for try := 1; try <= q.Retries && isTransient(err); try++ {
+		delay := q.w.retryDelay(try)
+		q.w.logf("mwclient: query failed: %v; retrying in %s", err, delay)
+		q.w.sleep(context.Background(), delay)
+		resp, err = q.w.callJSONWithOptions(q.params, opts)
+	}
+
+	if resp != nil || q.resp == nil {
+		q.resp = resp
+	}
+	q.err = err
+	return err == nil
+}
+
 // Next retrieves the next set of results from the API and makes them available
 // through the Resp method. Next returns true if new results are available
 // through Resp or false if there were no more results to request or if an
@@ -77,17 +155,27 @@ func (w *Client) NewQuery(p params.Values) *Query {
 func (q *Query) Next() (done bool) {
 	if q.resp == nil {
 		// first call to Next
-		q.resp, q.err = q.w.Get(q.params)
-		return q.err == nil
+		if q.RawContinue {
+			q.params.Del("continue")
+			q.params.Set("rawcontinue", "")
+		}
+		return q.get()
+	}
+
+	if q.RawContinue {
+		return q.rawContinue() && q.belowMaxRounds() && q.get()
 	}
 
 	cont, err := q.resp.GetObject("continue")
 	if err != nil {
 		return false
 	}
+	if !q.belowMaxRounds() {
+		return false
+	}
 	contMap := cont.Map()
 	for k, v := range contMap {
-		value, err := v.String()
+		value, err := continueValue(v)
 		if err != nil {
 			q.err = fmt.Errorf("response processing error: %v", err)
 			return false
@@ -95,6 +183,169 @@ func (q *Query) Next() (done bool) {
 		q.params.Set(k, value)
 	}
 
-	q.resp, q.err = q.w.Get(q.params)
-	return q.err == nil
+	return q.get()
+}
+
+// belowMaxRounds reports whether another request may be made according to
+// q.MaxRounds. If not, q.err is set to ErrContinuationLimit.
+func (q *Query) belowMaxRounds() bool {
+	if q.MaxRounds > 0 && q.rounds >= q.MaxRounds {
+		q.err = ErrContinuationLimit
+		return false
+	}
+	return true
+}
+
+// rawContinue sets the continuation parameters from the 'query-continue'
+// object of the last response, which is returned instead of 'continue' when
+// the rawcontinue parameter is set. It returns false if there are no more
+// results or if an error occurred.
+//
+// With a generator, the other modules must be continued until they have
+// returned all results for the current batch of generated pages before
+// the generator is continued.
+func (q *Query) rawContinue() bool {
+	cont, err := q.resp.GetObject("query-continue")
+	if err != nil {
+		return false
+	}
+
+	generator := q.params.Get("generator")
+	genCont := map[string]string{}
+	modCont := map[string]string{}
+	for module, v := range cont.Map() {
+		obj, err := v.Object()
+		if err != nil {
+			q.err = fmt.Errorf("response processing error: %v", err)
+			return false
+		}
+		for k, v := range obj.Map() {
+			value, err := continueValue(v)
+			if err != nil {
+				q.err = fmt.Errorf("response processing error: %v", err)
+				return false
+			}
+			if module == generator {
+				genCont[k] = value
+			} else {
+				modCont[k] = value
+			}
+		}
+	}
+
+	for _, k := range q.rawContinued {
+		q.params.Del(k)
+	}
+	q.rawContinued = nil
+	if len(modCont) == 0 {
+		for k, v := range genCont {
+			q.params.Set(k, v)
+		}
+		return true
+	}
+	for k, v := range modCont {
+		q.params.Set(k, v)
+		q.rawContinued = append(q.rawContinued, k)
+	}
+	return true
+}
+
+// continueValue returns the value of a continuation parameter.
+func continueValue(v *jason.Value) (string, error) {
+	value, err := v.String()
+	if err != nil {
+		// Some continuation values (e.g., qpoffset) are numbers.
+		n, nerr := v.Number()
+		if nerr != nil {
+			return "", err
+		}
+		value = n.String()
+	}
+	return value, nil
+}
+
+// GetAll makes the query specified by p, following continuations until all
+// results have been retrieved, and returns all responses. Like NewQuery,
+// GetAll sets action=query and continue= on p. If an error occurs,
+// the responses retrieved before the error are returned along with it.
+// For queries with many results, use NewQuery to process each response as it
+// is retrieved instead of keeping all of them in memory.
+func (w *Client) GetAll(p params.Values) ([]*jason.Object, error) {
+	var responses []*jason.Object
+	q := w.NewQuery(p)
+	for q.Next() {
+		responses = append(responses, q.Resp())
+	}
+	return responses, q.Err()
+}
+
+// MultiQuery makes a query with several list modules, e.g.
+// list=recentchanges|logevents, in one request, and returns the results of
+// each list keyed by the name of its module. Like NewQuery, MultiQuery sets
+// action=query and continue= on p.
+// Each list is continued independently: once all results of a list have been
+// retrieved, the API stops returning it while it continues the other lists.
+// If limit is positive, at most limit results are returned per list, and no
+// further requests are made once each list has limit results. Otherwise,
+// all results are retrieved.
+// If an error occurs, the results retrieved before the error are returned
+// along with it.
+func (w *Client) MultiQuery(p params.Values, limit int) (map[string][]*jason.Object, error) {
+	if p.Get("list") == "" {
+		return nil, ErrNoArgs
+	}
+	lists := params.SplitMultivalue(p.Get("list"))
+
+	results := make(map[string][]*jason.Object, len(lists))
+	err := w.queryEach(p, func(resp *jason.Object) error {
+		done := limit > 0
+		for _, list := range lists {
+			items, err := resp.GetObjectArray("query", list)
+			if err == nil {
+				results[list] = append(results[list], items...)
+			}
+			if limit > 0 && len(results[list]) > limit {
+				results[list] = results[list][:limit]
+			}
+			done = done && len(results[list]) == limit
+		}
+		if done {
+			return errStopQuery
+		}
+		return nil
+	})
+	return results, err
+}
+
+// queryEach makes the query specified by p, following continuations until
+// all results have been retrieved, and calls f with each response.
+// If f returns an error, no further requests are made and queryEach returns
+// the error, unless it is errStopQuery, in which case queryEach returns nil.
+func (w *Client) queryEach(p params.Values, f func(resp *jason.Object) error) error {
+	q := w.NewQuery(p)
+	for q.Next() {
+		if err := f(q.Resp()); err == errStopQuery {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return q.Err()
+}
+
+// errStopQuery is returned by a queryEach callback to stop the query without
+// an error, e.g. when enough results have been retrieved.
+var errStopQuery = errors.New("stop query")
+
+// unmarshalObject decodes o into the value pointed to by v
+// using encoding/json. Numbers decoded into interface{} values are decoded
+// as json.Number instead of float64, so that large IDs are not rounded.
+func unmarshalObject(o *jason.Object, v interface{}) error {
+	b, err := o.Marshal()
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
 }
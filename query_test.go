@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"cgt.name/pkg/go-mwclient/params"
+
+	"github.com/antonholmquist/jason"
 )
 
 func TestQuery(t *testing.T) {
@@ -51,3 +53,309 @@ func TestQuery(t *testing.T) {
 		t.Fatalf("q.Err() != nil: %v", err)
 	}
 }
+
+func TestGetAll(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if _, ok := r.Form["continue"]; !ok {
+			t.Fatalf("continue not set")
+		}
+		if r.Form.Get("apcontinue") == "" {
+			fmt.Fprint(w, `{"continue":{"apcontinue":"B","continue":"-||"},
+			"query":{"allpages":[{"title":"A"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"allpages":[{"title":"B"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	responses, err := client.GetAll(params.Values{"list": "allpages"})
+	if err != nil {
+		t.Fatalf("GetAll returned error: %v", err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("expected 2 responses, got %d", len(responses))
+	}
+	for i, want := range []string{"A", "B"} {
+		pages, err := responses[i].GetObjectArray("query", "allpages")
+		if err != nil || len(pages) != 1 {
+			t.Fatalf("unexpected response %d: %v", i, responses[i])
+		}
+		if title, _ := pages[0].GetString("title"); title != want {
+			t.Fatalf("title != %s: title=%s", want, title)
+		}
+	}
+}
+
+func TestQueryMaxRounds(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		fmt.Fprintf(w, `{"continue":{"apcontinue":"%d","continue":"-||"},
+		"query":{"allpages":[{"title":"%d"}]}}`, reqCount+1, reqCount)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	q := client.NewQuery(params.Values{"list": "allpages"})
+	q.MaxRounds = 3
+	responses := 0
+	for q.Next() {
+		responses++
+	}
+	if responses != 3 || reqCount != 3 {
+		t.Fatalf("expected 3 responses and requests, got %d and %d", responses, reqCount)
+	}
+	if q.Err() != ErrContinuationLimit {
+		t.Fatalf("Err != ErrContinuationLimit: Err=%v", q.Err())
+	}
+	if q.Resp() == nil {
+		t.Fatalf("last response not kept")
+	}
+}
+
+func TestMultiQuery(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if l := params.SplitMultivalue(r.Form.Get("list")); len(l) != 2 ||
+			l[0] != "recentchanges" || l[1] != "logevents" {
+			t.Fatalf("list != recentchanges|logevents: list=%q", r.Form.Get("list"))
+		}
+		switch r.Form.Get("continue") {
+		case "":
+			fmt.Fprint(w, `{"continue":{"rccontinue":"2","lecontinue":"2","continue":"-||"},
+			"query":{"recentchanges":[{"rcid":1}],"logevents":[{"logid":1}]}}`)
+		case "-||":
+			// logevents is complete, so only recentchanges is returned.
+			fmt.Fprint(w, `{"continue":{"rccontinue":"3","continue":"-||logevents"},
+			"query":{"recentchanges":[{"rcid":2}]}}`)
+		case "-||logevents":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"recentchanges":[{"rcid":3}]}}`)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	results, err := client.MultiQuery(params.Values{"list": "recentchanges|logevents"}, 0)
+	if err != nil {
+		t.Fatalf("MultiQuery returned error: %v", err)
+	}
+	if len(results["recentchanges"]) != 3 || len(results["logevents"]) != 1 {
+		t.Fatalf("expected 3 recent changes and 1 log event, got %d and %d",
+			len(results["recentchanges"]), len(results["logevents"]))
+	}
+
+	results, err = client.MultiQuery(params.Values{"list": "recentchanges|logevents"}, 1)
+	if err != nil {
+		t.Fatalf("MultiQuery returned error: %v", err)
+	}
+	if len(results["recentchanges"]) != 1 || len(results["logevents"]) != 1 {
+		t.Fatalf("expected 1 recent change and 1 log event, got %d and %d",
+			len(results["recentchanges"]), len(results["logevents"]))
+	}
+
+	// The list parameter may use the U+001F multi-value separator.
+	results, err = client.MultiQuery(params.Values{"list": "\x1frecentchanges\x1flogevents"}, 0)
+	if err != nil {
+		t.Fatalf("MultiQuery returned error: %v", err)
+	}
+	if len(results["recentchanges"]) != 3 || len(results["logevents"]) != 1 {
+		t.Fatalf("expected 3 recent changes and 1 log event, got %d and %d",
+			len(results["recentchanges"]), len(results["logevents"]))
+	}
+}
+
+func TestQueryRetry(t *testing.T) {
+	reqCount := 0
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		reqCount++
+		switch reqCount {
+		case 1:
+			fmt.Fprint(w, `{"continue":{"fkcontinue":"sendthisback","continue":"-||"}}`)
+		case 2:
+			// Transient failure: truncated response.
+			fmt.Fprint(w, `{"query":`)
+		case 3:
+			if r.Form.Get("fkcontinue") != "sendthisback" {
+				t.Fatalf("retried request did not resume from last continuation")
+			}
+			fmt.Fprint(w, "{}")
+		default:
+			t.Fatalf("unexpected request #%d", reqCount)
+		}
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	q := client.NewQuery(params.Values{})
+	q.Retries = 2
+	for q.Next() {
+		continue
+	}
+	if err := q.Err(); err != nil {
+		t.Fatalf("q.Err() != nil: %v", err)
+	}
+	if reqCount != 3 {
+		t.Fatalf("expected 3 requests, got %d", reqCount)
+	}
+}
+
+func TestQueryRetriesReplaceClientRetries(t *testing.T) {
+	reqCount := 0
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+	client.Retries = 3
+
+	q := client.NewQuery(params.Values{})
+	q.Retries = 1
+	for q.Next() {
+		continue
+	}
+	if _, ok := q.Err().(HTTPError); !ok {
+		t.Fatalf("expected HTTPError, got %#v", q.Err())
+	}
+	if reqCount != 2 {
+		t.Fatalf("expected 2 requests, got %d", reqCount)
+	}
+
+	// Without Query.Retries, Client.Retries applies.
+	reqCount = 0
+	q = client.NewQuery(params.Values{})
+	for q.Next() {
+		continue
+	}
+	if reqCount != 4 {
+		t.Fatalf("expected 4 requests, got %d", reqCount)
+	}
+}
+
+func TestQueryBatchComplete(t *testing.T) {
+	reqCount := 0
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		switch reqCount {
+		case 1:
+			fmt.Fprint(w, `{"continue":{"rvcontinue":"1|1","continue":"gapcontinue||"}}`)
+		case 2:
+			fmt.Fprint(w, `{"batchcomplete":true,"continue":{"gapcontinue":"B","continue":"gapcontinue||"}}`)
+		default:
+			// formatversion=1
+			fmt.Fprint(w, `{"batchcomplete":""}`)
+		}
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	q := client.NewQuery(params.Values{})
+	var complete []bool
+	for q.Next() {
+		complete = append(complete, q.BatchComplete())
+	}
+	if err := q.Err(); err != nil {
+		t.Fatalf("q.Err() != nil: %v", err)
+	}
+	if fmt.Sprint(complete) != "[false true true]" {
+		t.Fatalf("complete != [false true true]: complete=%v", complete)
+	}
+}
+
+func TestUnmarshalObjectLargeIDs(t *testing.T) {
+	// 2^53 + 1 cannot be represented exactly as a float64.
+	o, err := jason.NewObjectFromBytes([]byte(`{"revid":9007199254740993,"continue":{"offset":9007199254740993}}`))
+	if err != nil {
+		t.Fatalf("jason.NewObjectFromBytes returned error: %v", err)
+	}
+
+	var r struct {
+		RevID    int64                  `json:"revid"`
+		Continue map[string]interface{} `json:"continue"`
+	}
+	if err := unmarshalObject(o, &r); err != nil {
+		t.Fatalf("unmarshalObject returned error: %v", err)
+	}
+	if r.RevID != 9007199254740993 {
+		t.Errorf("r.RevID != 9007199254740993: r.RevID=%d", r.RevID)
+	}
+	if v := fmt.Sprint(r.Continue["offset"]); v != "9007199254740993" {
+		t.Errorf("offset != 9007199254740993: offset=%s", v)
+	}
+}
+
+func TestQueryRawContinue(t *testing.T) {
+	reqCount := 0
+	queryHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if _, ok := r.Form["rawcontinue"]; !ok {
+			t.Fatalf("rawcontinue not set")
+		}
+		if _, ok := r.Form["continue"]; ok {
+			t.Fatalf("continue set with rawcontinue")
+		}
+
+		reqCount++
+		gap, cl := r.Form.Get("gapcontinue"), r.Form.Get("clcontinue")
+		switch reqCount {
+		case 1:
+			if gap != "" || cl != "" {
+				t.Fatalf("request 1: unexpected continuation: gapcontinue=%s clcontinue=%s", gap, cl)
+			}
+			fmt.Fprint(w, `{"query-continue":{"categories":{"clcontinue":"1|B"},"allpages":{"gapcontinue":"C"}}}`)
+		case 2:
+			// The generator must not be continued before categories.
+			if gap != "" || cl != "1|B" {
+				t.Fatalf("request 2: unexpected continuation: gapcontinue=%s clcontinue=%s", gap, cl)
+			}
+			fmt.Fprint(w, `{"query-continue":{"allpages":{"gapcontinue":"C"}}}`)
+		case 3:
+			if gap != "C" || cl != "" {
+				t.Fatalf("request 3: unexpected continuation: gapcontinue=%s clcontinue=%s", gap, cl)
+			}
+			fmt.Fprint(w, `{}`)
+		default:
+			t.Fatalf("unexpected request #%d", reqCount)
+		}
+	}
+
+	server, client := setup(queryHandler)
+	defer server.Close()
+
+	q := client.NewQuery(params.Values{"generator": "allpages", "prop": "categories"})
+	q.RawContinue = true
+	for q.Next() {
+		continue
+	}
+	if err := q.Err(); err != nil {
+		t.Fatalf("q.Err() != nil: %v", err)
+	}
+	if reqCount != 3 {
+		t.Fatalf("expected 3 requests, got %d", reqCount)
+	}
+}
@@ -0,0 +1,97 @@
+package mwclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the rate of requests. The bucket
+// holds up to burst tokens and is refilled at rate tokens per second. Each
+// request takes one token, waiting until one is available if necessary.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait before
+// it may be used. If the bucket is empty, the token is borrowed from the
+// future, so that concurrent requests are spaced out evenly.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns a token taken by reserve that will not be used.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+}
+
+// SetRateLimit limits the rate at which the client sends requests to
+// requestsPerSecond, allowing bursts of up to burst requests at once. When
+// the limit is reached, requests wait until they may be sent, or until the
+// context of the request (see GetCtx) is canceled. Responses served from the
+// cache enabled with SetCache do not count towards the limit.
+// The limit applies to this Client only; clients for different wikis are
+// limited independently. If requestsPerSecond is not positive, requests are
+// not limited (the default). If burst is less than 1, it is set to 1.
+// SetRateLimit must not be called concurrently with requests.
+func (w *Client) SetRateLimit(requestsPerSecond float64, burst int) {
+	if requestsPerSecond <= 0 {
+		w.limiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	w.limiter = newRateLimiter(requestsPerSecond, burst)
+}
+
+// waitRateLimit waits until a request may be sent according to the limit set
+// with SetRateLimit. If ctx is canceled first, ctx.Err() is returned.
+func (w *Client) waitRateLimit(ctx context.Context) error {
+	l := w.limiter
+	if l == nil {
+		return nil
+	}
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+	if err := w.sleep(ctx, d); err != nil {
+		l.cancel()
+		return err
+	}
+	return nil
+}
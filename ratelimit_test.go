@@ -0,0 +1,89 @@
+package mwclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(2, 2)
+	l.now = func() time.Time { return now }
+
+	// The burst is available immediately.
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("expected no wait for request %d, got %s", i+1, d)
+		}
+	}
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Fatalf("expected wait of 500ms, got %s", d)
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Fatalf("expected wait of 1s, got %s", d)
+	}
+
+	// The bucket refills, but not beyond the burst.
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("expected no wait after refill, got %s", d)
+		}
+	}
+	if d := l.reserve(); d <= 0 {
+		t.Fatalf("expected wait after burst, got %s", d)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		reqCount++
+		fmt.Fprint(w, `{"batchcomplete":true}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	var waits []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	client.SetRateLimit(1, 1)
+	now := time.Now()
+	client.limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(params.Values{}); err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+	}
+	if reqCount != 3 {
+		t.Fatalf("expected 3 requests, got %d", reqCount)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Fatalf("unexpected waits: %v", waits)
+	}
+
+	// Waiting is interrupted by the context.
+	client.sleep = sleepContext
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetCtx(ctx, params.Values{}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if reqCount != 3 {
+		t.Fatalf("request sent although the context was canceled")
+	}
+
+	client.SetRateLimit(0, 0)
+	if _, err := client.Get(params.Values{}); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package mwclient
+
+import (
+	"sort"
+	"strconv"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// SearchResult is a page found by Client.Search.
+type SearchResult struct {
+	NS        int    `json:"ns"`
+	Title     string `json:"title"`
+	PageID    int    `json:"pageid"`
+	Size      int    `json:"size"`
+	WordCount int    `json:"wordcount"`
+	// Snippet is an excerpt of the page text in which the matches are
+	// highlighted with HTML (<span class="searchmatch">).
+	Snippet   string `json:"snippet"`
+	Timestamp string `json:"timestamp"`
+}
+
+// SearchResults is the outcome of a search, as returned by
+// Client.SearchDetailed.
+type SearchResults struct {
+	Results []SearchResult
+	// TotalHits is the total amount of pages that match the search,
+	// which may be more than the amount of results returned.
+	TotalHits int
+	// Suggestion is a corrected search query ("did you mean"),
+	// or empty if the search engine has no suggestion.
+	Suggestion string
+	// Interwiki maps interwiki prefixes of sister projects to the results
+	// found on them. It is nil unless interwiki results were requested.
+	Interwiki map[string][]SearchResult
+}
+
+// PlainSnippet returns the snippet of the result as plain text, without the
+// HTML highlighting of the matches.
+func (r SearchResult) PlainSnippet() string {
+	return stripTags(r.Snippet)
+}
+
+// searchMaxLimit is the maximum amount of search results the API returns in
+// one response.
+const searchMaxLimit = 500
+
+// Search performs a full-text search for query and returns the first limit
+// results (list=search). If limit is 0, the wiki's default limit (usually 10)
+// is used. If limit is more than the API returns in one response, the search
+// is continued until limit results have been retrieved or there are no more
+// results. If nothing is found, an empty slice is returned.
+// The snippets of the results are HTML; use SearchResult.PlainSnippet to get
+// them as plain text.
+func (w *Client) Search(query string, limit int) ([]SearchResult, error) {
+	r, err := w.search(query, limit, false)
+	return r.Results, err
+}
+
+// SearchDetailed is like Search, but also returns the total amount of hits
+// and the search engine's suggestion for query. If interwiki is true, results
+// from sister projects are included (srinterwiki), if the search engine
+// supports it.
+func (w *Client) SearchDetailed(query string, limit int, interwiki bool) (SearchResults, error) {
+	return w.search(query, limit, interwiki)
+}
+
+// search implements Search and SearchDetailed.
+func (w *Client) search(query string, limit int, interwiki bool) (SearchResults, error) {
+	p := params.Values{
+		"action":   "query",
+		"list":     "search",
+		"srsearch": query,
+		"srinfo":   "totalhits|suggestion",
+	}
+	if interwiki {
+		p["srinterwiki"] = ""
+	}
+
+	results := SearchResults{Results: []SearchResult{}}
+	var warnings error
+	for first := true; ; first = false {
+		if remaining := limit - len(results.Results); remaining > searchMaxLimit {
+			p["srlimit"] = strconv.Itoa(searchMaxLimit)
+		} else if limit > 0 {
+			p["srlimit"] = strconv.Itoa(remaining)
+		}
+
+		resp, err := w.Get(p)
+		if resp == nil {
+			return SearchResults{}, err
+		}
+		if _, ok := err.(APIWarnings); err != nil && !ok {
+			return SearchResults{}, err
+		}
+		if err != nil {
+			warnings = err
+		}
+
+		var r struct {
+			Continue struct {
+				SROffset *int `json:"sroffset"`
+			} `json:"continue"`
+			Query struct {
+				SearchInfo struct {
+					TotalHits  int    `json:"totalhits"`
+					Suggestion string `json:"suggestion"`
+				} `json:"searchinfo"`
+				Search          []SearchResult            `json:"search"`
+				InterwikiSearch map[string][]SearchResult `json:"interwikisearch"`
+			} `json:"query"`
+		}
+		if err := unmarshalObject(resp, &r); err != nil {
+			return SearchResults{}, err
+		}
+
+		results.Results = append(results.Results, r.Query.Search...)
+		if first {
+			results.TotalHits = r.Query.SearchInfo.TotalHits
+			results.Suggestion = r.Query.SearchInfo.Suggestion
+			if interwiki {
+				results.Interwiki = r.Query.InterwikiSearch
+				if results.Interwiki == nil {
+					results.Interwiki = map[string][]SearchResult{}
+				}
+			}
+		}
+
+		if limit <= 0 || len(results.Results) >= limit || r.Continue.SROffset == nil {
+			break
+		}
+		p["sroffset"] = strconv.Itoa(*r.Continue.SROffset)
+	}
+	return results, warnings
+}
+
+// FileSearchResult is a file found by Client.SearchFiles.
+type FileSearchResult struct {
+	Title string `json:"title"`
+	// URL is the URL of the original file.
+	URL string `json:"url"`
+	// DescriptionURL is the URL of the file description page.
+	DescriptionURL string `json:"descriptionurl"`
+	MIME           string `json:"mime"`
+	Size           int    `json:"size"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+}
+
+// SearchFiles performs a full-text search for query in the File namespace and
+// returns the first limit files found, with information about each file
+// (generator=search with prop=imageinfo). If limit is 0, the wiki's default
+// limit (usually 10) is used. Files in a shared repository (such as
+// Wikimedia Commons) are only found if their description pages are
+// searchable on the wiki.
+func (w *Client) SearchFiles(query string, limit int) ([]FileSearchResult, error) {
+	p := params.Values{
+		"action":       "query",
+		"generator":    "search",
+		"gsrsearch":    query,
+		"gsrnamespace": "6",
+		"prop":         "imageinfo",
+		"iiprop":       "url|size|mime",
+	}
+	if limit > 0 {
+		p["gsrlimit"] = strconv.Itoa(limit)
+	}
+
+	resp, err := w.Get(p)
+	if resp == nil {
+		return nil, err
+	}
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return nil, err
+	}
+	warnings := err
+
+	var r struct {
+		Query struct {
+			Pages []struct {
+				Title     string             `json:"title"`
+				Index     int                `json:"index"`
+				ImageInfo []FileSearchResult `json:"imageinfo"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+
+	// Pages are not returned in search order, which is given by the index.
+	pages := r.Query.Pages
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+	files := make([]FileSearchResult, 0, len(pages))
+	for _, page := range pages {
+		file := FileSearchResult{Title: page.Title}
+		if len(page.ImageInfo) > 0 {
+			file = page.ImageInfo[0]
+			file.Title = page.Title
+		}
+		files = append(files, file)
+	}
+	return files, warnings
+}
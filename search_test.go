@@ -0,0 +1,148 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("list"); v != "search" {
+			t.Fatalf("list != search: list=%s", v)
+		}
+		if v := r.Form.Get("srsearch"); v != "fooo" {
+			t.Fatalf("srsearch != fooo: srsearch=%s", v)
+		}
+		if v := r.Form.Get("srlimit"); v != "2" {
+			t.Fatalf("srlimit != 2: srlimit=%s", v)
+		}
+		if _, ok := r.Form["srinterwiki"]; !ok {
+			t.Fatalf("srinterwiki not set")
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"continue":{"sroffset":2,"continue":"-||"},
+		"query":{"searchinfo":{"totalhits":42,"suggestion":"foo"},
+		"search":[
+			{"ns":0,"title":"Foo","pageid":1,"size":100,"wordcount":10,
+			"snippet":"<span class=\"searchmatch\">Foo</span>","timestamp":"2020-01-01T00:00:00Z"},
+			{"ns":0,"title":"Food","pageid":2,"size":200,"wordcount":20,
+			"snippet":"","timestamp":"2020-01-02T00:00:00Z"}],
+		"interwikisearch":{"wikt":[{"ns":0,"title":"wikt:foo","pageid":3}]}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	r, err := client.SearchDetailed("fooo", 2, true)
+	if err != nil {
+		t.Fatalf("SearchDetailed returned error: %v", err)
+	}
+	if len(r.Results) != 2 || r.Results[0].Title != "Foo" || r.Results[1].Size != 200 {
+		t.Fatalf("unexpected results: %v", r.Results)
+	}
+	if r.TotalHits != 42 {
+		t.Fatalf("TotalHits != 42: TotalHits=%d", r.TotalHits)
+	}
+	if r.Suggestion != "foo" {
+		t.Fatalf("Suggestion != foo: Suggestion=%s", r.Suggestion)
+	}
+	if iw := r.Interwiki["wikt"]; len(iw) != 1 || iw[0].Title != "wikt:foo" {
+		t.Fatalf("unexpected interwiki results: %v", r.Interwiki)
+	}
+}
+
+func TestSearchContinue(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		switch offset := r.Form.Get("sroffset"); {
+		case r.Form.Get("srsearch") == "nothing":
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"searchinfo":{"totalhits":0},"search":[]}}`)
+		case offset == "":
+			if v := r.Form.Get("srlimit"); v != "500" {
+				t.Fatalf("srlimit != 500: srlimit=%s", v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"continue":{"sroffset":500,"continue":"-||"},
+			"query":{"searchinfo":{"totalhits":1000},"search":[{"ns":0,"title":"Foo",
+			"snippet":"A <span class=\"searchmatch\">foo</span> &amp; bar"}]}}`)
+		case offset == "500":
+			// Only one result has been returned, so 599 more are requested.
+			if v := r.Form.Get("srlimit"); v != "500" {
+				t.Fatalf("srlimit != 500: srlimit=%s", v)
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,
+			"query":{"searchinfo":{"totalhits":1000},"search":[{"ns":0,"title":"Bar"}]}}`)
+		default:
+			t.Fatalf("unexpected sroffset: %s", offset)
+		}
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	results, err := client.Search("foo", 600)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 2 || results[0].Title != "Foo" || results[1].Title != "Bar" {
+		t.Fatalf("unexpected results: %v", results)
+	}
+	if snippet := results[0].PlainSnippet(); snippet != "A foo & bar" {
+		t.Fatalf("PlainSnippet != A foo & bar: PlainSnippet=%s", snippet)
+	}
+
+	results, err = client.Search("nothing", 10)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if results == nil || len(results) != 0 {
+		t.Fatalf("expected empty results, got %#v", results)
+	}
+}
+
+func TestSearchFiles(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("gsrnamespace"); v != "6" {
+			t.Fatalf("gsrnamespace != 6: gsrnamespace=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[
+		{"pageid":2,"ns":6,"title":"File:B.png","index":2,"imagerepository":"local",
+		"imageinfo":[{"size":200,"width":20,"height":10,"url":"https://example.org/B.png",
+		"descriptionurl":"https://example.org/wiki/File:B.png","mime":"image/png"}]},
+		{"pageid":1,"ns":6,"title":"File:A.jpg","index":1,"imagerepository":"local",
+		"imageinfo":[{"size":100,"width":10,"height":5,"url":"https://example.org/A.jpg",
+		"descriptionurl":"https://example.org/wiki/File:A.jpg","mime":"image/jpeg"}]}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	files, err := client.SearchFiles("example", 2)
+	if err != nil {
+		t.Fatalf("SearchFiles returned error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if files[0].Title != "File:A.jpg" || files[0].MIME != "image/jpeg" || files[0].Width != 10 {
+		t.Fatalf("unexpected first file: %+v", files[0])
+	}
+	if files[1].URL != "https://example.org/B.png" {
+		t.Fatalf("unexpected second file: %+v", files[1])
+	}
+}
@@ -0,0 +1,122 @@
+package mwclient
+
+import (
+	"strings"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// namespaceInfo contains the namespaces of a wiki, as cached by
+// Client.Namespaces.
+type namespaceInfo struct {
+	// names maps namespace IDs to their localized names.
+	names map[int]string
+	// ids maps normalized (see normalizeNamespace) localized names,
+	// canonical names, and aliases to namespace IDs.
+	ids map[string]int
+}
+
+// normalizeNamespace returns the namespace name name in a form suitable for
+// case-insensitive comparison.
+func normalizeNamespace(name string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Replace(name, "_", " ", -1)))
+}
+
+// Namespaces returns the namespaces of the wiki as a map of namespace IDs to
+// their localized names (e.g., 4 to "Wikipedia"). The name of the main
+// namespace is the empty string. The namespaces are retrieved with
+// meta=siteinfo on the first call and cached for the lifetime of the client.
+func (w *Client) Namespaces() (map[int]string, error) {
+	ns, err := w.namespaceInfo()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(ns.names))
+	for id, name := range ns.names {
+		names[id] = name
+	}
+	return names, nil
+}
+
+// NamespaceByName returns the ID of the namespace with the localized name,
+// canonical name, or alias name, e.g. 4 for "Project", "Wikipedia", or "WP"
+// on the English Wikipedia. Names are matched case-insensitively, and
+// underscores are treated as spaces. NamespaceByName returns false if there
+// is no such namespace or if the namespaces could not be retrieved
+// (see Namespaces).
+func (w *Client) NamespaceByName(name string) (int, bool) {
+	ns, err := w.namespaceInfo()
+	if err != nil {
+		return 0, false
+	}
+	id, ok := ns.ids[normalizeNamespace(name)]
+	return id, ok
+}
+
+// NamespaceName returns the localized name of the namespace with the ID id.
+// NamespaceName returns false if there is no such namespace or if the
+// namespaces could not be retrieved (see Namespaces).
+func (w *Client) NamespaceName(id int) (string, bool) {
+	ns, err := w.namespaceInfo()
+	if err != nil {
+		return "", false
+	}
+	name, ok := ns.names[id]
+	return name, ok
+}
+
+// namespaceInfo returns the cached namespaces of the wiki, retrieving them
+// first if necessary. If retrieving them fails, they are retrieved again
+// on the next call.
+func (w *Client) namespaceInfo() (*namespaceInfo, error) {
+	w.namespacesMu.Lock()
+	defer w.namespacesMu.Unlock()
+	if w.namespaces != nil {
+		return w.namespaces, nil
+	}
+
+	p := params.Values{
+		"action": "query",
+		"meta":   "siteinfo",
+		"siprop": "namespaces|namespacealiases",
+	}
+	resp, err := w.Get(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Query struct {
+			Namespaces map[string]struct {
+				ID        int    `json:"id"`
+				Name      string `json:"name"`
+				Canonical string `json:"canonical"`
+			} `json:"namespaces"`
+			NamespaceAliases []struct {
+				ID    int    `json:"id"`
+				Alias string `json:"alias"`
+			} `json:"namespacealiases"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+
+	ns := &namespaceInfo{
+		names: make(map[int]string, len(r.Query.Namespaces)),
+		ids:   map[string]int{},
+	}
+	for _, n := range r.Query.Namespaces {
+		ns.names[n.ID] = n.Name
+		ns.ids[normalizeNamespace(n.Name)] = n.ID
+		if n.Canonical != "" {
+			ns.ids[normalizeNamespace(n.Canonical)] = n.ID
+		}
+	}
+	for _, alias := range r.Query.NamespaceAliases {
+		ns.ids[normalizeNamespace(alias.Alias)] = alias.ID
+	}
+
+	w.namespaces = ns
+	return ns, nil
+}
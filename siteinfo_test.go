@@ -0,0 +1,49 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	reqCount := 0
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("siprop"); v != "namespaces|namespacealiases" {
+			t.Fatalf("siprop != namespaces|namespacealiases: siprop=%s", v)
+		}
+
+		reqCount++
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"namespaces":{
+		"0":{"id":0,"case":"first-letter","name":"","content":true},
+		"4":{"id":4,"case":"first-letter","name":"Wikipedia","canonical":"Project"},
+		"5":{"id":5,"case":"first-letter","name":"Wikipedia talk","canonical":"Project talk"}},
+		"namespacealiases":[{"id":4,"alias":"WP"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	for _, name := range []string{"Wikipedia", "project", "WP"} {
+		if id, ok := client.NamespaceByName(name); !ok || id != 4 {
+			t.Errorf("NamespaceByName(%q) != 4: id=%d ok=%t", name, id, ok)
+		}
+	}
+	if id, ok := client.NamespaceByName("Project_talk"); !ok || id != 5 {
+		t.Errorf("NamespaceByName(Project_talk) != 5: id=%d ok=%t", id, ok)
+	}
+	if _, ok := client.NamespaceByName("Nonexistent"); ok {
+		t.Errorf("NamespaceByName(Nonexistent) found a namespace")
+	}
+	if name, ok := client.NamespaceName(5); !ok || name != "Wikipedia talk" {
+		t.Errorf("NamespaceName(5) != Wikipedia talk: name=%s ok=%t", name, ok)
+	}
+	if reqCount != 1 {
+		t.Fatalf("expected namespaces to be requested once, got %d requests", reqCount)
+	}
+}
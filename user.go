@@ -0,0 +1,148 @@
+package mwclient
+
+import (
+	"fmt"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// RateLimit is a limit of Hits actions per Seconds seconds.
+type RateLimit struct {
+	Hits    int `json:"hits"`
+	Seconds int `json:"seconds"`
+}
+
+// RateLimits returns the rate limits that apply to the current user,
+// keyed by action (e.g., "edit" or "move").
+// MediaWiki may apply several limits to one action (e.g., a per-user and a
+// per-IP limit). In that case, the most restrictive limit is returned.
+// Actions that are not rate limited for the current user are not included.
+func (w *Client) RateLimits() (map[string]RateLimit, error) {
+	p := params.Values{
+		"action": "query",
+		"meta":   "userinfo",
+		"uiprop": "ratelimits",
+	}
+
+	resp, err := w.Get(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		Query struct {
+			UserInfo struct {
+				RateLimits map[string]map[string]RateLimit `json:"ratelimits"`
+			} `json:"userinfo"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return nil, err
+	}
+
+	return effectiveRateLimits(r.Query.UserInfo.RateLimits), nil
+}
+
+// UserInfo is information about the user the client is acting as, as returned
+// by meta=userinfo.
+type UserInfo struct {
+	// ID is 0 and Anon is true if the client is not logged in. Name is then
+	// the IP address the request was made from.
+	ID     int
+	Name   string
+	Anon   bool
+	Groups []string
+	Rights []string
+	// RateLimits are the rate limits that apply to the user, as returned by
+	// RateLimits.
+	RateLimits map[string]RateLimit
+}
+
+// UserInfo returns information about the user the client is currently acting
+// as (meta=userinfo). It is always requested from the API, never served from
+// the cache enabled with SetCache. If the client is not logged in, the
+// information of the anonymous user is returned rather than an error, even
+// if Assert is set.
+func (w *Client) UserInfo() (UserInfo, error) {
+	p := params.Values{
+		"action": "query",
+		"meta":   "userinfo",
+		"uiprop": "groups|rights|ratelimits",
+	}
+
+	// The assertions would fail if the session has expired.
+	resp, err := w.callJSONWithOptions(p, callOptions{fresh: true, noAssert: true})
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	var r struct {
+		Query struct {
+			UserInfo struct {
+				ID         int                             `json:"id"`
+				Name       string                          `json:"name"`
+				Anon       bool                            `json:"anon"`
+				Groups     []string                        `json:"groups"`
+				Rights     []string                        `json:"rights"`
+				RateLimits map[string]map[string]RateLimit `json:"ratelimits"`
+			} `json:"userinfo"`
+		} `json:"query"`
+	}
+	if err := unmarshalObject(resp, &r); err != nil {
+		return UserInfo{}, err
+	}
+
+	ui := r.Query.UserInfo
+	return UserInfo{
+		ID:         ui.ID,
+		Name:       ui.Name,
+		Anon:       ui.Anon || ui.ID == 0,
+		Groups:     ui.Groups,
+		Rights:     ui.Rights,
+		RateLimits: effectiveRateLimits(ui.RateLimits),
+	}, nil
+}
+
+// LoggedIn reports whether the client has a valid logged-in session, i.e.
+// whether the API considers it to be acting as a registered user
+// (meta=userinfo). Like UserInfo, it always queries the API. The assertions
+// set with Assert and AssertUsername are not added to the request, so a
+// dropped session is reported as false rather than as an error. LoggedIn does
+// not change the tokens or other state of the client.
+func (w *Client) LoggedIn() (bool, error) {
+	p := params.Values{
+		"action": "query",
+		"meta":   "userinfo",
+	}
+
+	resp, err := w.callJSONWithOptions(p, callOptions{fresh: true, noAssert: true})
+	if err != nil {
+		return false, err
+	}
+
+	id, err := resp.GetInt64("query", "userinfo", "id")
+	if err != nil {
+		return false, fmt.Errorf("unrecognized response: %v", resp)
+	}
+	return id != 0, nil
+}
+
+// effectiveRateLimits picks the most restrictive limit for each action
+// from a userinfo ratelimits object, which maps from action to the
+// category of the limit (e.g., "user" or "ip") to the limit itself.
+func effectiveRateLimits(limits map[string]map[string]RateLimit) map[string]RateLimit {
+	effective := make(map[string]RateLimit, len(limits))
+	for action, categories := range limits {
+		for _, limit := range categories {
+			if limit.Seconds <= 0 {
+				continue
+			}
+			current, ok := effective[action]
+			// Compare hits/seconds without converting to floats.
+			if !ok || limit.Hits*current.Seconds < current.Hits*limit.Seconds {
+				effective[action] = limit
+			}
+		}
+	}
+	return effective
+}
@@ -0,0 +1,126 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRateLimits(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("uiprop"); v != "ratelimits" {
+			t.Fatalf("uiprop != ratelimits: uiprop=%s", v)
+		}
+
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"userinfo":{"id":1,"name":"MyBot",
+		"ratelimits":{"edit":{"user":{"hits":90,"seconds":60},"ip":{"hits":8,"seconds":60}},
+		"move":{"user":{"hits":8,"seconds":60}}}}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	limits, err := client.RateLimits()
+	if err != nil {
+		t.Fatalf("RateLimits returned error: %v", err)
+	}
+	if len(limits) != 2 {
+		t.Fatalf("expected 2 limits, got %d: %v", len(limits), limits)
+	}
+	if l := limits["edit"]; l.Hits != 8 || l.Seconds != 60 {
+		t.Errorf("expected most restrictive edit limit 8/60, got %d/%d", l.Hits, l.Seconds)
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	loggedIn := true
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("meta"); v != "userinfo" {
+			t.Fatalf("meta != userinfo: meta=%s", v)
+		}
+		if !loggedIn {
+			if r.Form.Get("assert") != "" {
+				fmt.Fprint(w, `{"error":{"code":"assertuserfailed","info":"You are no longer logged in."}}`)
+				return
+			}
+			fmt.Fprint(w, `{"batchcomplete":true,"query":{"userinfo":{"id":0,"name":"127.0.0.1",
+			"anon":true,"groups":["*"],"rights":["read"],"ratelimits":{}}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"userinfo":{"id":1,"name":"MyBot",
+		"groups":["bot","*","user"],"rights":["read","edit","bot"],
+		"ratelimits":{"edit":{"user":{"hits":90,"seconds":60}}}}}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	info, err := client.UserInfo()
+	if err != nil {
+		t.Fatalf("UserInfo returned error: %v", err)
+	}
+	if info.ID != 1 || info.Name != "MyBot" || info.Anon {
+		t.Fatalf("unexpected user info: %+v", info)
+	}
+	if len(info.Groups) != 3 || len(info.Rights) != 3 || info.Rights[2] != "bot" {
+		t.Fatalf("unexpected groups or rights: %+v", info)
+	}
+	if l := info.RateLimits["edit"]; l.Hits != 90 || l.Seconds != 60 {
+		t.Fatalf("unexpected edit rate limit: %v", info.RateLimits)
+	}
+
+	loggedIn = false
+	client.Assert = AssertUser
+	info, err = client.UserInfo()
+	if err != nil {
+		t.Fatalf("UserInfo returned error: %v", err)
+	}
+	if info.ID != 0 || !info.Anon || info.Name != "127.0.0.1" {
+		t.Fatalf("unexpected anonymous user info: %+v", info)
+	}
+}
+
+func TestLoggedIn(t *testing.T) {
+	id := 1
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("meta"); v != "userinfo" {
+			t.Fatalf("meta != userinfo: meta=%s", v)
+		}
+		if v := r.Form.Get("assert"); v != "" {
+			t.Fatalf("assert should not be set: assert=%s", v)
+		}
+		fmt.Fprintf(w, `{"batchcomplete":true,"query":{"userinfo":{"id":%d,"name":"MyBot"}}}`, id)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Assert = AssertUser
+	client.Tokens[CSRFToken] = "VALIDTOKEN"
+	if ok, err := client.LoggedIn(); err != nil || !ok {
+		t.Fatalf("LoggedIn() = %v, %v; want true", ok, err)
+	}
+
+	id = 0
+	if ok, err := client.LoggedIn(); err != nil || ok {
+		t.Fatalf("LoggedIn() = %v, %v; want false", ok, err)
+	}
+	if client.Tokens[CSRFToken] != "VALIDTOKEN" {
+		t.Fatalf("LoggedIn changed the tokens: %v", client.Tokens)
+	}
+}
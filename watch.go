@@ -0,0 +1,67 @@
+package mwclient
+
+import (
+	"errors"
+	"strings"
+
+	"cgt.name/pkg/go-mwclient/params"
+)
+
+// ErrWatchlistExpiryUnsupported is returned by Client.Watch() when
+// an expiry is given, but the wiki does not support watchlist expiry.
+var ErrWatchlistExpiryUnsupported = errors.New("wiki does not support watchlist expiry")
+
+// Watch adds the pages titles to the watchlist of the current user.
+// If expiry is non-empty, the pages are watched temporarily. expiry may be
+// relative (e.g., "1 week") or absolute (e.g., "2020-10-01T00:00:00Z").
+// An empty expiry, or "infinite", watches the pages permanently.
+// If expiry is non-empty and the wiki does not support watchlist expiry
+// (MediaWiki < 1.35), ErrWatchlistExpiryUnsupported is returned.
+func (w *Client) Watch(titles []string, expiry string) error {
+	p := params.Values{"action": "watch"}
+	p.AddRange("titles", titles...)
+	if expiry != "" {
+		p["expiry"] = expiry
+	}
+
+	_, err := w.postWithToken(WatchToken, p)
+	if warnings, ok := err.(APIWarnings); ok && expiry != "" {
+		for _, warn := range warnings {
+			if strings.Contains(warn.Info, "Unrecognized parameter") &&
+				strings.Contains(warn.Info, "expiry") {
+				return ErrWatchlistExpiryUnsupported
+			}
+		}
+	}
+	return err
+}
+
+// Unwatch removes the pages titles from the watchlist of the current user.
+func (w *Client) Unwatch(titles []string) error {
+	p := params.Values{
+		"action":  "watch",
+		"unwatch": "",
+	}
+	p.AddRange("titles", titles...)
+
+	_, err := w.postWithToken(WatchToken, p)
+	return err
+}
+
+// WatchExpiry reports whether the current user is watching the page title,
+// and if so, when the page will expire from the user's watchlist.
+// expiry is empty if the page is watched permanently or the wiki does not
+// support watchlist expiry.
+func (w *Client) WatchExpiry(title string) (watched bool, expiry string, err error) {
+	page, err := w.getPageInfo(title, "watched")
+	if _, ok := err.(APIWarnings); err != nil && !ok {
+		return false, "", err
+	}
+	if !page.Watched {
+		return false, "", err
+	}
+	if page.WatchlistExpiry == "infinity" {
+		return true, "", err
+	}
+	return true, page.WatchlistExpiry, err
+}
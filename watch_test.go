@@ -0,0 +1,69 @@
+package mwclient
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestWatchExpiryUnsupported(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if v := r.Form.Get("expiry"); v != "1 week" {
+			t.Fatalf("expiry != 1 week: expiry=%s", v)
+		}
+
+		fmt.Fprint(w, `{"warnings":{"main":{"warnings":"Unrecognized parameter: expiry."}},
+		"watch":[{"title":"Foo","watched":true}]}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	client.Tokens[WatchToken] = "WATCHTOKEN"
+	err := client.Watch([]string{"Foo"}, "1 week")
+	if err != ErrWatchlistExpiryUnsupported {
+		t.Fatalf("expected ErrWatchlistExpiryUnsupported, got %v", err)
+	}
+}
+
+func TestWatchExpiry(t *testing.T) {
+	httpHandler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			panic("Bad HTTP form")
+		}
+
+		if r.Form.Get("titles") == "Bar" {
+			fmt.Fprint(w, `{"warnings":{"info":{"warnings":"The parameter is deprecated."}},
+			"batchcomplete":true,"query":{"pages":[{"pageid":2,"ns":0,
+			"title":"Bar","watched":true,"watchlistexpiry":"infinity"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"batchcomplete":true,"query":{"pages":[{"pageid":1,"ns":0,
+		"title":"Foo","watched":true,"watchlistexpiry":"2020-10-01T00:00:00Z"}]}}`)
+	}
+
+	server, client := setup(httpHandler)
+	defer server.Close()
+
+	watched, expiry, err := client.WatchExpiry("Foo")
+	if err != nil {
+		t.Fatalf("WatchExpiry returned error: %v", err)
+	}
+	if !watched || expiry != "2020-10-01T00:00:00Z" {
+		t.Errorf("unexpected result: watched=%v expiry=%s", watched, expiry)
+	}
+
+	watched, expiry, err = client.WatchExpiry("Bar")
+	if _, ok := err.(APIWarnings); !ok {
+		t.Fatalf("expected APIWarnings, got %v", err)
+	}
+	if !watched || expiry != "" {
+		t.Errorf("unexpected result with warnings: watched=%v expiry=%s", watched, expiry)
+	}
+}